@@ -0,0 +1,323 @@
+// Command dshards encrypts, decrypts, and inspects Datashards, and manages
+// mutable datashards.
+//
+// Usage:
+//
+//	dshards encrypt [-suite 0p] [-variadic] [-workers N] -dir DIR [FILE]
+//	dshards decrypt -dir DIR IDSC
+//	dshards inspect IDSC|MDSC|URN
+//	dshards attenuate [-to read|verify] MDSC
+//	dshards mdsc new [-suite 0p] -dir DIR
+//	dshards mdsc publish -dir DIR MDSC [FILE]
+//	dshards mdsc log -dir DIR MDSC
+//	dshards mdsc cat -dir DIR MDSC
+//
+// Shards are stored in DIR in the layout of a dshards.DirStore. When FILE is
+// omitted or "-", encrypt and mdsc publish read from standard input.
+//
+// The mdsc log command lists each revision and whether its signature verifies,
+// exiting with an error if any does not. The mdsc cat command prints the latest
+// revision, or the revision an MDSC is pinned to, such as "MDSC/2/".
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/cjslep/dshards"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+
+	symmKeyLen = 32
+)
+
+const usage = `usage:
+  dshards encrypt [-suite 0p] [-variadic] [-workers N] -dir DIR [FILE]
+  dshards decrypt -dir DIR IDSC
+  dshards inspect IDSC|MDSC|URN
+  dshards attenuate [-to read|verify] MDSC
+  dshards mdsc new [-suite 0p] -dir DIR
+  dshards mdsc publish -dir DIR MDSC [FILE]
+  dshards mdsc log -dir DIR MDSC
+  dshards mdsc cat -dir DIR MDSC
+`
+
+// errUsage indicates the command was invoked incorrectly, after the usage has
+// already been reported.
+var errUsage = errors.New("usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the arguments, returning the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	var cmd func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+	switch args[0] {
+	case "encrypt":
+		cmd = encrypt
+	case "decrypt":
+		cmd = decrypt
+	case "inspect":
+		cmd = inspect
+	case "attenuate":
+		cmd = attenuate
+	case "mdsc":
+		cmd = mdscCmd
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "dshards: unknown command %q\n%s", args[0], usage)
+		return exitUsage
+	}
+	if err := cmd(args[1:], stdin, stdout, stderr); err == errUsage {
+		return exitUsage
+	} else if err != nil {
+		fmt.Fprintf(stderr, "dshards %s: %s\n", args[0], err)
+		return exitError
+	}
+	return exitOK
+}
+
+// newFlagSet creates the flags of a subcommand, reporting errors to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("dshards "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags parses the subcommand's flags, expecting between min and max
+// positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	} else if fs.NArg() < min || fs.NArg() > max {
+		fmt.Fprintf(fs.Output(), "%s: expected between %d and %d arguments, got %d\n", fs.Name(), min, max, fs.NArg())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func encrypt(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("encrypt", stderr)
+	suite := fs.String("suite", string(dshards.PROTO_ZERO_SUITE), "suite of encryption protocols")
+	variadic := fs.Bool("variadic", false, "pad the final shard to the smallest allowed size")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of shards to encrypt concurrently")
+	dir := fs.String("dir", "", "directory to store the shards in")
+	if err = parseFlags(fs, args, 0, 1); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards encrypt: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	r := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		var f *os.File
+		f, err = os.Open(name)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+	key := make(dshards.SymmetricKey, symmKeyLen)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return
+	}
+	ctx := context.Background()
+	opts := dshards.EncryptOptions{VariadicChunks: *variadic, Workers: *workers}
+	var root dshards.PrivateShard
+	root, err = opts.EncryptReader(r, key, dshards.Suite(*suite), dshards.NewStoreSink(ctx, dshards.NewDirStore(*dir)))
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(stdout, root.AddressAndKey)
+	return
+}
+
+func decrypt(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("decrypt", stderr)
+	dir := fs.String("dir", "", "directory the shards are stored in")
+	if err = parseFlags(fs, args, 1, 1); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards decrypt: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var idsc dshards.IDSC
+	idsc, err = dshards.ParseIDSC(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	var u dshards.URN
+	u, err = idsc.URN()
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	st := dshards.NewDirStore(*dir)
+	root := dshards.PrivateShard{AddressAndKey: idsc}
+	root.Content, err = st.Fetch(ctx, u)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", u, err)
+	}
+	r := dshards.NewDecryptingReader(root, idsc.Suite(), st)
+	defer r.Close()
+	_, err = io.Copy(stdout, r)
+	return
+}
+
+func inspect(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("inspect", stderr)
+	if err = parseFlags(fs, args, 1, 1); err != nil {
+		return
+	}
+	s := fs.Arg(0)
+	switch {
+	case strings.HasPrefix(s, "idsc:"):
+		err = inspectIDSC(s, stdout)
+	case strings.HasPrefix(s, "mdsc:"):
+		err = inspectMDSC(s, stdout)
+	case strings.HasPrefix(s, "urn:"):
+		err = inspectURN(s, stdout)
+	default:
+		err = fmt.Errorf("%q is not an idsc, mdsc, or urn", s)
+	}
+	return
+}
+
+func inspectIDSC(s string, w io.Writer) (err error) {
+	var idsc dshards.IDSC
+	idsc, err = dshards.ParseIDSC(s)
+	if err != nil {
+		return
+	}
+	var u dshards.URN
+	u, err = idsc.URN()
+	if err != nil {
+		return
+	}
+	return printFields(w, [][2]string{
+		{"type", "idsc"},
+		{"suite", string(idsc.Suite())},
+		{"hash", string(u.Algorithm())},
+		{"urn", u.String()},
+	})
+}
+
+func inspectMDSC(s string, w io.Writer) (err error) {
+	var c dshards.Cap
+	c, err = dshards.ParseMDSC(s)
+	if err != nil {
+		return
+	}
+	var u dshards.URN
+	u, err = c.KeyDataURN()
+	if err != nil {
+		return
+	}
+	version := "latest"
+	if n, hash, ok := c.Version(); ok {
+		version = fmt.Sprintf("%d", n)
+		if len(hash) > 0 {
+			version += " " + base64.RawURLEncoding.EncodeToString(hash)
+		}
+	}
+	return printFields(w, [][2]string{
+		{"type", "mdsc"},
+		{"access", accessLevel(c)},
+		{"suite", string(c.Suite())},
+		{"keydata", u.String()},
+		{"version", version},
+	})
+}
+
+func inspectURN(s string, w io.Writer) (err error) {
+	var u dshards.URN
+	u, err = dshards.ParseURN(s)
+	if err != nil {
+		return
+	}
+	return printFields(w, [][2]string{
+		{"type", "urn"},
+		{"hash", string(u.Algorithm())},
+	})
+}
+
+// accessLevel describes what a capability is able to do.
+func accessLevel(c dshards.Cap) string {
+	switch c.(type) {
+	case dshards.ReadWriteCap:
+		return "read-write"
+	case dshards.ReadCap:
+		return "read"
+	default:
+		return "verify"
+	}
+}
+
+// printFields prints each name and value on its own line.
+func printFields(w io.Writer, fields [][2]string) error {
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(w, "%-8s %s\n", f[0]+":", f[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attenuate(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("attenuate", stderr)
+	to := fs.String("to", "read", "access level to attenuate to: read or verify")
+	if err = parseFlags(fs, args, 1, 1); err != nil {
+		return
+	}
+	var c dshards.Cap
+	c, err = dshards.ParseMDSC(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	var out dshards.Cap
+	switch *to {
+	case "read":
+		w, ok := c.(dshards.ReadWriteCap)
+		if !ok {
+			return fmt.Errorf("a %s capability cannot be attenuated to read", accessLevel(c))
+		}
+		out = w.ReadCap()
+	case "verify":
+		r, ok := c.(dshards.ReadCap)
+		if !ok {
+			return fmt.Errorf("a %s capability cannot be attenuated to verify", accessLevel(c))
+		}
+		out = r.VerifyCap()
+	default:
+		fmt.Fprintf(stderr, "dshards attenuate: unknown access level %q\n", *to)
+		fs.Usage()
+		return errUsage
+	}
+	_, err = fmt.Fprintln(stdout, out)
+	return
+}
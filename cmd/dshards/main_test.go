@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjslep/dshards"
+)
+
+// runTest runs the command, returning its exit code, stdout, and stderr.
+func runTest(stdin []byte, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, bytes.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dshards-cmd")
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	shards := filepath.Join(dir, "shards")
+	plain := bytes.Repeat([]byte("datashards "), 10000)
+	file := filepath.Join(dir, "plain")
+	if err = ioutil.WriteFile(file, plain, 0600); err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin []byte
+	}{
+		{
+			name: "File",
+			args: []string{"encrypt", "-dir", shards, file},
+		},
+		{
+			name:  "Stdin",
+			args:  []string{"encrypt", "-dir", shards, "-suite", string(dshards.PROTO_ZERO_AEAD_SUITE), "-variadic"},
+			stdin: plain,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out, errOut := runTest(test.stdin, test.args...)
+			if code != exitOK {
+				t.Fatalf("got exit code %d: %s", code, errOut)
+			}
+			idsc := strings.TrimSpace(out)
+			if _, err := dshards.ParseIDSC(idsc); err != nil {
+				t.Fatalf("got invalid idsc %q: %s", idsc, err)
+			}
+
+			code, out, errOut = runTest(nil, "decrypt", "-dir", shards, idsc)
+			if code != exitOK {
+				t.Fatalf("got exit code %d: %s", code, errOut)
+			} else if out != string(plain) {
+				t.Errorf("got len %d, want len %d", len(out), len(plain))
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	rw, _, _, err := dshards.NewMDSC(dshards.PROTO_ZERO_ED25519_SUITE, rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	u, err := rw.KeyDataURN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name         string
+		input        string
+		expectCode   int
+		expectFields []string
+	}{
+		{
+			name:       "IDSC",
+			input:      "idsc:0p.X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo.eekxqfiZIcEnc8cpR-sD_3X3qLaTzQW-KnovArMkGP0",
+			expectCode: exitOK,
+			expectFields: []string{
+				"type:    idsc",
+				"suite:   0p",
+				"hash:    sha256d",
+				"urn:     urn:sha256d:X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo",
+			},
+		},
+		{
+			name:       "Read-Write MDSC",
+			input:      rw.String(),
+			expectCode: exitOK,
+			expectFields: []string{
+				"type:    mdsc",
+				"access:  read-write",
+				"suite:   0pe",
+				"keydata: " + u.String(),
+				"version: latest",
+			},
+		},
+		{
+			name:       "Pinned Verify MDSC",
+			input:      rw.VerifyCap().AtVersion(3, []byte{1, 2, 3}).String(),
+			expectCode: exitOK,
+			expectFields: []string{
+				"access:  verify",
+				"version: 3 AQID",
+			},
+		},
+		{
+			name:       "URN",
+			input:      "urn:sha256d:X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo",
+			expectCode: exitOK,
+			expectFields: []string{
+				"type:    urn",
+				"hash:    sha256d",
+			},
+		},
+		{
+			name:       "Unknown",
+			input:      "http://example.com",
+			expectCode: exitError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out, errOut := runTest(nil, "inspect", test.input)
+			if code != test.expectCode {
+				t.Fatalf("got exit code %d, want %d: %s", code, test.expectCode, errOut)
+			}
+			lines := strings.Split(out, "\n")
+			for _, f := range test.expectFields {
+				found := false
+				for _, l := range lines {
+					if l == f {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("got %q, missing %q", out, f)
+				}
+			}
+		})
+	}
+}
+
+func TestAttenuate(t *testing.T) {
+	rw, _, _, err := dshards.NewMDSC(dshards.PROTO_ZERO_ED25519_SUITE, rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		expectCode int
+		expect     string
+	}{
+		{
+			name:       "Write To Read",
+			args:       []string{rw.String()},
+			expectCode: exitOK,
+			expect:     rw.ReadCap().String(),
+		},
+		{
+			name:       "Write To Verify",
+			args:       []string{"-to", "verify", rw.String()},
+			expectCode: exitOK,
+			expect:     rw.VerifyCap().String(),
+		},
+		{
+			name:       "Read To Verify",
+			args:       []string{"-to", "verify", rw.ReadCap().String()},
+			expectCode: exitOK,
+			expect:     rw.VerifyCap().String(),
+		},
+		{
+			name:       "Verify To Read",
+			args:       []string{rw.VerifyCap().String()},
+			expectCode: exitError,
+		},
+		{
+			name:       "Unknown Level",
+			args:       []string{"-to", "write", rw.String()},
+			expectCode: exitUsage,
+		},
+		{
+			name:       "No Capability",
+			args:       []string{},
+			expectCode: exitUsage,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out, errOut := runTest(nil, append([]string{"attenuate"}, test.args...)...)
+			if code != test.expectCode {
+				t.Fatalf("got exit code %d, want %d: %s", code, test.expectCode, errOut)
+			} else if got := strings.TrimSpace(out); got != test.expect {
+				t.Errorf("got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _, _ := runTest(nil); code != exitUsage {
+		t.Errorf("got exit code %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runTest(nil, "frobnicate"); code != exitUsage {
+		t.Errorf("got exit code %d, want %d", code, exitUsage)
+	}
+}
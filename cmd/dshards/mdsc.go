@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cjslep/dshards"
+)
+
+const mdscUsage = `usage:
+  dshards mdsc new [-suite 0p] -dir DIR
+  dshards mdsc publish -dir DIR MDSC [FILE]
+  dshards mdsc log -dir DIR MDSC
+  dshards mdsc cat -dir DIR MDSC
+`
+
+// mdscCmd runs the subcommands that manage the lifecycle of a mutable
+// datashard.
+func mdscCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, mdscUsage)
+		return errUsage
+	}
+	var cmd func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+	switch args[0] {
+	case "new":
+		cmd = mdscNew
+	case "publish":
+		cmd = mdscPublish
+	case "log":
+		cmd = mdscLog
+	case "cat":
+		cmd = mdscCat
+	default:
+		fmt.Fprintf(stderr, "dshards mdsc: unknown command %q\n%s", args[0], mdscUsage)
+		return errUsage
+	}
+	err := cmd(args[1:], stdin, stdout, stderr)
+	if err != nil && err != errUsage {
+		err = fmt.Errorf("%s: %w", args[0], err)
+	}
+	return err
+}
+
+func mdscNew(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("mdsc new", stderr)
+	suite := fs.String("suite", string(dshards.PROTO_ZERO_SUITE), "suite of encryption and signing protocols")
+	dir := fs.String("dir", "", "directory to store the keydata in")
+	if err = parseFlags(fs, args, 0, 0); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards mdsc new: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var c dshards.ReadWriteCap
+	var priv []dshards.PrivateShard
+	c, _, priv, err = dshards.NewMDSC(dshards.Suite(*suite), rand.Reader)
+	if err != nil {
+		return
+	}
+	sink := dshards.NewStoreSink(context.Background(), dshards.NewDirStore(*dir))
+	for _, p := range priv {
+		if err = sink.Put(p); err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintln(stdout, c)
+	return
+}
+
+func mdscPublish(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("mdsc publish", stderr)
+	dir := fs.String("dir", "", "directory the mutable datashard is stored in")
+	if err = parseFlags(fs, args, 1, 2); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards mdsc publish: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var c dshards.Cap
+	c, err = dshards.ParseMDSC(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	w, ok := c.(dshards.ReadWriteCap)
+	if !ok {
+		return fmt.Errorf("a %s capability cannot publish", accessLevel(c))
+	}
+	r := stdin
+	if name := fs.Arg(1); name != "" && name != "-" {
+		var f *os.File
+		f, err = os.Open(name)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+	var rev int
+	rev, err = dshards.Publish(context.Background(), w, r, dshards.NewDirStore(*dir))
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(stdout, rev)
+	return
+}
+
+// mdscLog lists every revision and whether its signature verifies. The URN
+// of each revision is also listed when the capability can read it.
+func mdscLog(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("mdsc log", stderr)
+	dir := fs.String("dir", "", "directory the mutable datashard is stored in")
+	if err = parseFlags(fs, args, 1, 1); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards mdsc log: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var c dshards.Cap
+	c, err = dshards.ParseMDSC(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	st := dshards.NewDirStore(*dir)
+	var h *dshards.HistoryVerifyOnly
+	var readable *dshards.HistoryReadOnly
+	switch v := c.(type) {
+	case dshards.ReadCap:
+		readable, err = dshards.FetchReadableHistory(ctx, v, st)
+		if readable != nil {
+			h = &readable.HistoryVerifyOnly
+		}
+	case dshards.VerifyCap:
+		h, err = dshards.FetchHistory(ctx, v, st)
+	}
+	if err != nil {
+		return
+	}
+
+	failed := 0
+	for i := 0; i < h.Len(); i++ {
+		fields := []string{strconv.Itoa(i)}
+		verr := h.Verify(i)
+		if readable != nil {
+			// Only a verified revision is trusted to locate its content.
+			u := "-"
+			if verr == nil {
+				var urn dshards.URN
+				urn, err = readable.ReadURN(i)
+				if err != nil {
+					return
+				}
+				u = urn.String()
+			}
+			fields = append(fields, u)
+		}
+		if verr != nil {
+			fields = append(fields, "FAILED: "+verr.Error())
+			failed++
+		} else {
+			fields = append(fields, "ok")
+		}
+		if _, err = fmt.Fprintln(stdout, strings.Join(fields, "\t")); err != nil {
+			return
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d revisions failed to verify", failed, h.Len())
+	}
+	return
+}
+
+// mdscCat writes the content of the latest revision, or of the revision the
+// capability is pinned to, after verifying the whole History.
+func mdscCat(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("mdsc cat", stderr)
+	dir := fs.String("dir", "", "directory the mutable datashard is stored in")
+	if err = parseFlags(fs, args, 1, 1); err != nil {
+		return
+	} else if *dir == "" {
+		fmt.Fprintln(stderr, "dshards mdsc cat: -dir is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var c dshards.Cap
+	c, err = dshards.ParseMDSC(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	r, ok := c.(dshards.ReadCap)
+	if !ok {
+		return fmt.Errorf("a %s capability cannot read", accessLevel(c))
+	}
+	var content []byte
+	_, content, err = dshards.ResolveLatest(context.Background(), r, dshards.NewDirStore(*dir))
+	if err != nil {
+		return
+	}
+	_, err = stdout.Write(content)
+	return
+}
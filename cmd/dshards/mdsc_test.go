@@ -0,0 +1,215 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cjslep/dshards"
+)
+
+// newTestMDSC creates a mutable datashard in the directory, returning its
+// capability.
+func newTestMDSC(t *testing.T, dir string) dshards.ReadWriteCap {
+	code, out, errOut := runTest(nil, "mdsc", "new", "-suite", string(dshards.PROTO_ZERO_ED25519_SUITE), "-dir", dir)
+	if code != exitOK {
+		t.Fatalf("got exit code %d: %s", code, errOut)
+	}
+	c, err := dshards.ParseMDSC(strings.TrimSpace(out))
+	if err != nil {
+		t.Fatalf("got invalid mdsc %q: %s", out, err)
+	}
+	w, ok := c.(dshards.ReadWriteCap)
+	if !ok {
+		t.Fatalf("got %s capability, want read-write", accessLevel(c))
+	}
+	return w
+}
+
+// testHistoryPath is the file of the mutable datashard's History in the
+// directory.
+func testHistoryPath(t *testing.T, dir string, c dshards.Cap) string {
+	u, err := c.KeyDataURN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	s := u.String()
+	return filepath.Join(dir, "history", string(u.Algorithm()), s[strings.LastIndex(s, ":")+1:])
+}
+
+func TestMDSCLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dshards-cmd")
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	w := newTestMDSC(t, dir)
+
+	// A new mutable datashard has an empty History.
+	if code, out, errOut := runTest(nil, "mdsc", "log", "-dir", dir, w.ReadCap().String()); code != exitOK {
+		t.Fatalf("got exit code %d: %s", code, errOut)
+	} else if out != "" {
+		t.Errorf("got %q, want no revisions logged", out)
+	}
+	if code, _, errOut := runTest(nil, "mdsc", "cat", "-dir", dir, w.ReadCap().String()); code == exitOK {
+		t.Errorf("got exit code %d, want an error", code)
+	} else if !strings.Contains(errOut, "no revisions") {
+		t.Errorf("got %q, want no revisions", errOut)
+	}
+
+	revisions := []string{"first revision", "second revision"}
+	for i, r := range revisions {
+		code, out, errOut := runTest([]byte(r), "mdsc", "publish", "-dir", dir, w.String())
+		if code != exitOK {
+			t.Fatalf("got exit code %d: %s", code, errOut)
+		} else if got := strings.TrimSpace(out); got != strconv.Itoa(i) {
+			t.Errorf("got revision %s, want %d", got, i)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect string
+	}{
+		{
+			name:   "Cat Latest",
+			args:   []string{"cat", "-dir", dir, w.ReadCap().String()},
+			expect: revisions[1],
+		},
+		{
+			name:   "Cat Pinned",
+			args:   []string{"cat", "-dir", dir, w.ReadCap().AtVersion(0, nil).String()},
+			expect: revisions[0],
+		},
+		{
+			name:   "Log Verify",
+			args:   []string{"log", "-dir", dir, w.ReadCap().VerifyCap().String()},
+			expect: "0\tok\n1\tok\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out, errOut := runTest(nil, append([]string{"mdsc"}, test.args...)...)
+			if code != exitOK {
+				t.Fatalf("got exit code %d: %s", code, errOut)
+			} else if out != test.expect {
+				t.Errorf("got %q, want %q", out, test.expect)
+			}
+		})
+	}
+
+	code, out, errOut := runTest(nil, "mdsc", "log", "-dir", dir, w.ReadCap().String())
+	if code != exitOK {
+		t.Fatalf("got exit code %d: %s", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != len(revisions) {
+		t.Fatalf("got %d revisions logged, want %d: %q", len(lines), len(revisions), out)
+	}
+	for i, l := range lines {
+		fields := strings.Split(l, "\t")
+		if len(fields) != 3 {
+			t.Errorf("got %q, want revision, urn, and status", l)
+		} else if _, err := dshards.ParseURN(fields[1]); err != nil {
+			t.Errorf("got invalid urn in %q: %s", l, err)
+		} else if fields[0] != strconv.Itoa(i) || fields[2] != "ok" {
+			t.Errorf("got %q for revision %d", l, i)
+		}
+	}
+}
+
+func TestMDSCTamperedHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dshards-cmd")
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	w := newTestMDSC(t, dir)
+	other := newTestMDSC(t, dir)
+	if code, _, errOut := runTest([]byte("forged"), "mdsc", "publish", "-dir", dir, other.String()); code != exitOK {
+		t.Fatalf("got exit code %d: %s", code, errOut)
+	}
+	// Replace the History with one signed by a different key.
+	b, err := ioutil.ReadFile(testHistoryPath(t, dir, other))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	p := testHistoryPath(t, dir, w)
+	if err = os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if err = ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectPrefix string
+	}{
+		{
+			name:         "Log Verify",
+			args:         []string{"log", "-dir", dir, w.ReadCap().VerifyCap().String()},
+			expectPrefix: "0\tFAILED: ",
+		},
+		{
+			name:         "Log Read",
+			args:         []string{"log", "-dir", dir, w.ReadCap().String()},
+			expectPrefix: "0\t-\tFAILED: ",
+		},
+		{
+			name: "Cat",
+			args: []string{"cat", "-dir", dir, w.ReadCap().String()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, out, _ := runTest(nil, append([]string{"mdsc"}, test.args...)...)
+			if code != exitError {
+				t.Fatalf("got exit code %d, want %d", code, exitError)
+			} else if !strings.HasPrefix(out, test.expectPrefix) {
+				t.Errorf("got %q, want prefix %q", out, test.expectPrefix)
+			} else if test.expectPrefix == "" && out != "" {
+				t.Errorf("got %q, want no output", out)
+			}
+		})
+	}
+}
+
+func TestMDSCUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		expectCode int
+	}{
+		{
+			name:       "No Command",
+			expectCode: exitUsage,
+		},
+		{
+			name:       "Unknown Command",
+			args:       []string{"frobnicate"},
+			expectCode: exitUsage,
+		},
+		{
+			name:       "Missing Dir",
+			args:       []string{"new"},
+			expectCode: exitUsage,
+		},
+		{
+			name:       "Publish Without Write",
+			args:       []string{"publish", "-dir", "unused", "mdsc:r.0p.gl6qBg6i3dc5dz9cylxPcxIWn4SgLdTxWFzyqtwIljk.6B4Vy69Z6GnqF3VAk8eZkUBZbXgR5tWWoC1C_6Pbe7g.wtNehlhYRxooG1un7cLBDMvjs2S-uEz1jLFgfDEH3Cs"},
+			expectCode: exitError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code, _, errOut := runTest(nil, append([]string{"mdsc"}, test.args...)...); code != test.expectCode {
+				t.Errorf("got exit code %d, want %d: %s", code, test.expectCode, errOut)
+			}
+		})
+	}
+}
@@ -3,15 +3,20 @@ package dshards
 import (
 	"bytes"
 	"crypto"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 )
 
+// ErrAuthentication indicates that encrypted content failed to authenticate
+// when decrypted by a suite that uses an AEAD, so it was corrupted or tampered
+// with.
+var ErrAuthentication = errors.New("dshards: encrypted content failed authentication")
+
 // SymmetricKey types these bytes as a symmetric key, which should be treated
 // with the same care as a private key.
 type SymmetricKey []byte
@@ -50,78 +55,185 @@ type PublicShard struct {
 	Address URN
 }
 
+// ShardSink receives each PrivateShard as soon as it has been encrypted.
+type ShardSink interface {
+	Put(p PrivateShard) error
+}
+
+// ShardSinkFunc adapts an ordinary function into a ShardSink.
+type ShardSinkFunc func(p PrivateShard) error
+
+// Put calls f(p).
+func (f ShardSinkFunc) Put(p PrivateShard) error {
+	return f(p)
+}
+
+// EncryptOptions configures how content is encrypted into Datashards. The zero
+// value is what Encrypt and EncryptReader use.
+type EncryptOptions struct {
+	// VariadicChunks pads the final Datashard of content, and of the
+	// manifest, to the smallest allowed chunk size of 1, 2, 4, 8, 16, or 32
+	// KiB that fits. Otherwise, every Datashard is padded to 32 KiB.
+	//
+	// Variadic chunking saves space for small content at the cost of
+	// revealing its approximate size.
+	VariadicChunks bool
+	// Workers is how many chunks are encrypted concurrently. Zero or one
+	// encrypts each chunk in turn. The shards are given to the sink in the
+	// same order, and are identical, regardless of the number of workers.
+	//
+	// Up to this many chunks of content are held in memory at a time.
+	Workers int
+}
+
 // Encrypt applies the Datashards encryption and sharding algorithm.
+//
+// Both the plaintext and the resulting shards are held in memory. Use
+// EncryptReader for large content.
 func Encrypt(plain []byte, key SymmetricKey, s Suite) (rootIdx int, priv []PrivateShard, err error) {
-	r := raw{content: plain}
-	return encrypt(r, key, s)
+	return EncryptOptions{}.Encrypt(plain, key, s)
+}
+
+// EncryptReader applies the Datashards encryption and sharding algorithm to
+// the content read from r. Each PrivateShard is given to the sink as soon as it
+// has been encrypted, with the root shard given last and also returned.
+//
+// Only one chunk of content is held in memory at a time, alongside the
+// manifest being filled at each level of the manifest tree. See
+// EncryptOptions.Workers to encrypt chunks concurrently.
+func EncryptReader(r io.Reader, key SymmetricKey, s Suite, sink ShardSink) (root PrivateShard, err error) {
+	return EncryptOptions{}.EncryptReader(r, key, s, sink)
+}
+
+// Encrypt is like the package Encrypt, using these options.
+func (o EncryptOptions) Encrypt(plain []byte, key SymmetricKey, s Suite) (rootIdx int, priv []PrivateShard, err error) {
+	_, err = o.EncryptReader(bytes.NewReader(plain), key, s, ShardSinkFunc(func(p PrivateShard) error {
+		priv = append(priv, p)
+		return nil
+	}))
+	if err != nil {
+		return
+	}
+	// The root shard is always the last one encrypted.
+	rootIdx = len(priv) - 1
+	return
 }
 
-func encrypt(c chunker, key SymmetricKey, s Suite) (rootIdx int, priv []PrivateShard, err error) {
-	var plain [][]byte
-	plain, err = c.Chunk()
+// EncryptReader is like the package EncryptReader, using these options.
+func (o EncryptOptions) EncryptReader(r io.Reader, key SymmetricKey, s Suite, sink ShardSink) (root PrivateShard, err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
+	if err != nil {
+		return
+	}
+	eachChunk := []interface{}{kRaw}
+	size := constChunkSize - impl.Overhead()
+	var n int
+	n, err = chunkCapacity(eachChunk, size)
 	if err != nil {
 		return
 	}
-	priv = make([]PrivateShard, len(plain))
-	m := manifest{
-		urns: make([]URN, len(plain)),
+	cur := make([]byte, n)
+	next := make([]byte, n)
+	var curLen int
+	curLen, err = readChunk(r, cur)
+	if err != nil {
+		return
 	}
-	// Use entry-point IV if content fits within a single shard. Otherwise,
-	// use the content IV.
-	var ivFn ivFunc
-	if len(plain) == 1 {
-		ivFn = ivEntryPoint
-	} else {
-		ivFn = ivContent
+	var tree *treeBuilder
+	tree, err = newTreeBuilder(key, s, o.VariadicChunks, impl.Overhead(), sink)
+	if err != nil {
+		return
 	}
-	for i, plainChunk := range plain {
-		priv[i], err = encryptChunk(plainChunk, key, s, uint64(i), ivFn)
+	// Every datashard of content holds n bytes, except for the last.
+	var read, added int64
+	enc := newChunkEncrypter(key, s, o.Workers, func(p PrivateShard) error {
+		if err := sink.Put(p); err != nil {
+			return err
+		}
+		urn, err := p.AddressAndKey.URN()
 		if err != nil {
-			return
+			return err
+		}
+		size := read - added
+		if size > int64(n) {
+			size = int64(n)
+		}
+		added += size
+		return tree.add(1, urn, size)
+	})
+	var ctr uint64
+	for {
+		// Only a full chunk may be followed by more content.
+		var nextLen int
+		if curLen == len(cur) {
+			nextLen, err = readChunk(r, next)
+			if err != nil {
+				return
+			}
+		}
+		var plain []byte
+		if nextLen == 0 {
+			plain, err = encodeFinalChunk(eachChunk, cur[:curLen], o.VariadicChunks, impl.Overhead())
+		} else {
+			plain, err = encodeChunk(eachChunk, cur[:curLen], size)
 		}
-		m.urns[i], err = priv[i].AddressAndKey.URN()
 		if err != nil {
 			return
 		}
-	}
-	if len(priv) == 1 {
-		rootIdx = 0
-	} else {
-		var more []PrivateShard
-		rootIdx, more, err = encrypt(m, key, s)
-		if err != nil {
+		// Use entry-point IV if content fits within a single shard.
+		// Otherwise, use the content IV.
+		if ctr == 0 && nextLen == 0 {
+			root, err = encryptChunk(plain, key, s, 0, ivEntryPoint)
+			if err != nil {
+				return
+			}
+			err = sink.Put(root)
+			return
+		}
+		read += int64(curLen)
+		if err = enc.add(plain, ctr, ivContent); err != nil {
 			return
 		}
-		rootIdx += len(priv)
-		priv = append(priv, more...)
+		ctr++
+		if nextLen == 0 {
+			break
+		}
+		cur, next = next, cur
+		curLen = nextLen
+	}
+	if err = enc.flush(); err != nil {
+		return
+	}
+	return tree.finish()
+}
+
+// readChunk fills as much of b as possible from r, returning a short count
+// without error only when r is exhausted.
+func readChunk(r io.Reader, b []byte) (n int, err error) {
+	n, err = io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
 	}
 	return
 }
 
 func encryptChunk(plain []byte, key SymmetricKey, s Suite, ctr uint64, ivFn ivFunc) (priv PrivateShard, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-	var ch crypto.Hash
-	ch, err = s.ivHash()
+	var iv []byte
+	iv, err = ivFn(ctr, key)
 	if err != nil {
 		return
 	}
-	var iv []byte
-	iv, err = ivFn(ctr, key)
+	var ciphertext []byte
+	ciphertext, err = impl.EncryptShard(plain, key, impl.DeriveIV(iv))
 	if err != nil {
 		return
 	}
-	h := ch.New()
-	h.Write(iv)
-	ivo := h.Sum(nil)
-	ivt := ivo[:block.BlockSize()]
-	stream := cipher.NewCTR(block, ivt)
-
-	ciphertext := make([]byte, len(plain))
-	stream.XORKeyStream(ciphertext, plain)
 
 	var idsc IDSC
 	idsc, err = NewIDSC(s, ciphertext, key)
@@ -142,8 +254,13 @@ type Result struct {
 	content []byte
 
 	// Internal: If a manifest exists, the length of the content specified
-	// in the manifest. Set when 'fetch' is set.
+	// in the manifest, and the level of the manifest tree of the datashards
+	// to fetch. Set when 'fetch' is set.
 	contentLen int64
+	level      int
+	// Internal: Whether the datashards to fetch are beneath a legacy
+	// manifest, whose tree does not record its levels.
+	legacy bool
 }
 
 // ToFetch contains additional URN addresses to obtain and decrypt using
@@ -164,17 +281,58 @@ func (r *Result) Content() []byte {
 	return r.content
 }
 
+// ErrHashMismatch indicates that the encrypted content of a Datashard does not
+// hash to the URN it was expected to have, so it was corrupted or tampered
+// with.
+type ErrHashMismatch struct {
+	// The URN the content was expected to have.
+	URN URN
+	// The position of the Datashard amongst the fetched results, or -1
+	// for the root Datashard.
+	Index int
+}
+
+func (e *ErrHashMismatch) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("dshards: root datashard content does not match %s", e.URN)
+	}
+	return fmt.Sprintf("dshards: %dth fetched datashard content does not match %s", e.Index, e.URN)
+}
+
+// verifyShard ensures the encrypted content has the expected URN before it is
+// decrypted.
+func verifyShard(content []byte, expected URN, idx int) error {
+	ok, err := expected.Matches(content)
+	if err != nil {
+		return err
+	} else if !ok {
+		return &ErrHashMismatch{URN: expected, Index: idx}
+	}
+	return nil
+}
+
 // Decrypt applies the Datashards decryption algorithm onto the root Datashard.
 //
 // The Result will either indicate that more data is needed or provide the
 // decrypted content. If more data is needed, use DecryptFetchedResult.
+//
+// The encrypted content is verified to match the address of the root
+// Datashard, returning an *ErrHashMismatch if it does not.
 func Decrypt(root PrivateShard, s Suite) (r *Result, err error) {
+	var u URN
+	u, err = root.AddressAndKey.URN()
+	if err != nil {
+		return
+	}
+	if err = verifyShard(root.Content, u, -1); err != nil {
+		return
+	}
 	var pt []byte
 	pt, err = decryptChunk(root.Content, root.AddressAndKey.symmKey, s, 0, ivEntryPoint)
 	if err != nil {
 		return
 	}
-	r, err = decode(pt)
+	r, err = decodeRoot(pt, s)
 	return
 }
 
@@ -182,54 +340,104 @@ func Decrypt(root PrivateShard, s Suite) (r *Result, err error) {
 // Datashards obtained from a Result that indicated more data was needed in
 // ToFetch.
 //
-// The results in priv must be in the same order as listed in the Result.
+// The results in priv must be in the same order as listed in the Result. They
+// either hold content, or are the next level of the manifest tree, in which
+// case the next Result indicates more data is needed.
+//
+// The encrypted content of each result is verified to match the URN listed in
+// the Result, returning an *ErrHashMismatch if it does not.
 func DecryptFetchedResult(prev *Result, priv []PrivateShard, s Suite) (next *Result, err error) {
-	next = &Result{}
+	return DecryptOptions{}.DecryptFetchedResult(prev, priv, s)
+}
+
+// DecryptOptions configures how Datashards are decrypted. The zero value is
+// what DecryptFetchedResult and DecryptAll use.
+type DecryptOptions struct {
+	// Workers is how many Datashards are verified and decrypted
+	// concurrently. Zero or one decrypts each Datashard in turn. The
+	// decrypted content, and any error, is the same regardless of the
+	// number of workers.
+	Workers int
+}
+
+// DecryptFetchedResult is like the package DecryptFetchedResult, using these
+// options.
+func (o DecryptOptions) DecryptFetchedResult(prev *Result, priv []PrivateShard, s Suite) (next *Result, err error) {
+	if len(priv) != len(prev.fetch) {
+		err = fmt.Errorf("decrypting %d fetched results but expected %d", len(priv), len(prev.fetch))
+		return
+	}
+
+	ivFn := ivLevel(prev.level)
+	if prev.legacy {
+		// Every datashard beneath a legacy manifest, whether content or
+		// part of a manifest, uses the content IVs.
+		ivFn = ivContent
+	}
 
 	// Decrypt all chunks.
-	for i, pr := range priv {
+	decoded := make([]decodedShard, len(priv))
+	err = parallelFor(len(priv), o.Workers, func(i int) (err error) {
+		if err = verifyShard(priv[i].Content, prev.fetch[i], i); err != nil {
+			return
+		}
 		var pt []byte
-		pt, err = decryptChunk(pr.Content, pr.AddressAndKey.symmKey, s, uint64(i), ivContent)
+		pt, err = decryptChunk(priv[i].Content, priv[i].AddressAndKey.symmKey, s, uint64(i), ivFn)
 		if err != nil {
 			return
 		}
-		var r *Result
-		r, err = decode(pt)
+		decoded[i], err = decodeShard(pt)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// Manifests list the next level of Datashards to fetch.
+	next = &Result{}
+	if prev.legacy && len(decoded) > 0 && decoded[0].isManifest {
+		next.contentLen = prev.contentLen
+		next.legacy = true
+		next.fetch, err = decodeLegacyManifests(decoded)
+		return
+	} else if prev.level > 0 {
+		var shape treeShape
+		shape, err = newTreeShape(s, prev.contentLen)
 		if err != nil {
 			return
-		} else if len(r.fetch) > 0 {
-			err = fmt.Errorf("malformed datashard: decrypting %dth fetched results encountered unexpected type %q", i, kManifest)
-			return
 		}
-		next.content = append(next.content, r.content...)
+		next.contentLen = prev.contentLen
+		next.level = prev.level - 1
+		next.fetch, err = decodeManifestLevel(decoded, prev.level, shape)
+		return
 	}
 
+	var content []byte
+	for i, d := range decoded {
+		if d.isManifest {
+			err = fmt.Errorf("malformed datashard: decrypting %dth fetched result expected %q but got %q", i, kRaw, d.tag())
+			return
+		}
+		content = append(content, d.content...)
+	}
 	// Check the length and maybe eliminate padding.
-	if int64(len(next.content)) < prev.contentLen {
-		err = fmt.Errorf("malformed datashard: decrypting yielded %d of %d bytes", len(next.content), prev.contentLen)
+	if int64(len(content)) < prev.contentLen {
+		err = fmt.Errorf("malformed datashard: decrypting yielded %d of %d bytes", len(content), prev.contentLen)
 		return
-	} else if int64(len(next.content)) > prev.contentLen {
-		next.content = next.content[:prev.contentLen]
-	}
-
-	// Determine if this is a manifest -- an error will arise if it is not.
-	maybeManifest, errM := decode(next.content)
-	if errM == nil {
-		next = maybeManifest
-	} else {
-		// Ignore, it is raw content
+	} else if int64(len(content)) > prev.contentLen {
+		content = content[:prev.contentLen]
 	}
+	next.content = content
 	return
 }
 
 func decryptChunk(ciphertext []byte, key SymmetricKey, s Suite, ctr uint64, ivFn ivFunc) (plaintext []byte, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
-	if err != nil {
+	if !isAllowedChunkSize(len(ciphertext)) {
+		err = fmt.Errorf("malformed datashard: %d bytes is not an allowed size", len(ciphertext))
 		return
 	}
-	var ch crypto.Hash
-	ch, err = s.ivHash()
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
@@ -238,14 +446,7 @@ func decryptChunk(ciphertext []byte, key SymmetricKey, s Suite, ctr uint64, ivFn
 	if err != nil {
 		return
 	}
-	h := ch.New()
-	h.Write(iv)
-	ivo := h.Sum(nil)
-	ivt := ivo[:block.BlockSize()]
-	stream := cipher.NewCTR(block, ivt)
-
-	plaintext = make([]byte, len(ciphertext))
-	stream.XORKeyStream(plaintext, ciphertext)
+	plaintext, err = impl.DecryptShard(ciphertext, key, impl.DeriveIV(iv))
 	return
 }
 
@@ -254,6 +455,7 @@ func decryptChunk(ciphertext []byte, key SymmetricKey, s Suite, ctr uint64, ivFn
 const (
 	ivEntryPointPrefix = "entry-point"
 	ivContentPrefix    = "content"
+	ivManifestPrefix   = "manifest"
 )
 
 type ivFunc func(ctr uint64, key SymmetricKey) ([]byte, error)
@@ -288,6 +490,17 @@ func toReadKey(writeKey SymmetricKey) SymmetricKey {
 	return r[:]
 }
 
+// revisionKey derives the symmetric key of the content of the nth revision
+// from the read key and the revision's salt, so that no two revisions share a
+// key and IVs.
+func revisionKey(readKey SymmetricKey, n int64, salt []byte) SymmetricKey {
+	m := hmac.New(sha256.New, readKey)
+	m.Write([]byte("revision"))
+	binary.Write(m, binary.LittleEndian, n)
+	m.Write(salt)
+	return m.Sum(nil)
+}
+
 type pubKey struct {
 	N *big.Int `syrup:"n"`
 	E int      `syrup:"e"`
@@ -304,101 +517,84 @@ type privKey struct {
 	QInv *big.Int `syrup:"qInv"`
 }
 
+type ed25519PrivKey struct {
+	Seed []byte `syrup:"seed"`
+}
+
 // Encrypts the write key for a KeyData entry.
 func encryptWriteKey(plain []byte, key SymmetricKey, s Suite) (enc []byte, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-	// Zeroed IV
-	iv := make([]byte, block.BlockSize())
-	stream := cipher.NewCTR(block, iv)
-
-	enc = make([]byte, len(plain))
-	stream.XORKeyStream(enc, plain)
+	enc, err = impl.WrapKey(plain, key)
 	return
 }
 
 // Decrypts the write key for a KeyData entry.
 func decryptWriteKey(crypt []byte, key SymmetricKey, s Suite) (plain []byte, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-	// Zeroed IV
-	iv := make([]byte, block.BlockSize())
-	stream := cipher.NewCTR(block, iv)
-
-	plain = make([]byte, len(crypt))
-	stream.XORKeyStream(plain, crypt)
+	plain, err = impl.UnwrapKey(crypt, key)
 	return
 }
 
 // Encrypts the URN in a history entry
 func encryptURN(plain []byte, key SymmetricKey, s Suite) (crypt, iv []byte, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-	iv = make([]byte, block.BlockSize())
-	var n int
-	n, err = rand.Read(iv)
-	if err != nil {
-		return
-	} else if n != block.BlockSize() {
-		err = fmt.Errorf("crypto/rand read %d of %d bytes", n, block.BlockSize())
-		return
-	}
-	stream := cipher.NewCTR(block, iv)
-
-	crypt = make([]byte, len(plain))
-	stream.XORKeyStream(crypt, plain)
+	crypt, iv, err = impl.EncryptLocation(plain, key)
 	return
 }
 
 // Decrypts the URN in a history entry
 func decryptURN(crypt, iv []byte, key SymmetricKey, s Suite) (plain []byte, err error) {
-	var block cipher.Block
-	block, err = s.blockCipher(key)
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-	stream := cipher.NewCTR(block, iv)
-
-	plain = make([]byte, len(crypt))
-	stream.XORKeyStream(plain, crypt)
+	plain, err = impl.DecryptLocation(crypt, iv, key)
 	return
 }
 
 // Signs the revision in a history entry
-func signRevision(priv *rsa.PrivateKey, toSign []byte, s Suite) (sig []byte, err error) {
-	var ch crypto.Hash
-	ch, err = s.historySignatureHash()
+func signRevision(priv crypto.Signer, toSign []byte, s Suite) (sig []byte, err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
-
-	h := ch.New()
-	h.Write(toSign)
-	hashToSign := h.Sum(nil)
-	sig, err = rsa.SignPKCS1v15(rand.Reader, priv, ch, hashToSign)
+	sig, err = impl.SignRevision(priv, toSign)
 	return
 }
 
 // Verifies the revision in a history entry
-func verifyRevision(pub *rsa.PublicKey, toVerify, sig []byte, s Suite) (err error) {
-	var ch crypto.Hash
-	ch, err = s.historySignatureHash()
+func verifyRevision(pub crypto.PublicKey, toVerify, sig []byte, s Suite) (err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
 	if err != nil {
 		return
 	}
+	err = impl.VerifyRevision(pub, toVerify, sig)
+	return
+}
 
-	h := ch.New()
-	h.Write(toVerify)
-	hashToVerify := h.Sum(nil)
-	err = rsa.VerifyPKCS1v15(pub, ch, hashToVerify, sig)
+// generateSigningKey creates a new private key that signs revisions for the
+// suite.
+func generateSigningKey(s Suite, rand io.Reader) (priv crypto.Signer, err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
+	if err != nil {
+		return
+	}
+	priv, err = impl.GenerateSigningKey(rand)
 	return
 }
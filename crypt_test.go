@@ -0,0 +1,321 @@
+package dshards
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// testContent creates deterministic, non-syrup content of length n.
+func testContent(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + i%26)
+	}
+	return b
+}
+
+// decryptShards applies the decryption algorithm to the output of Encrypt,
+// looking up fetched URNs within the shards.
+func decryptShards(t *testing.T, rootIdx int, priv []PrivateShard, s Suite) []byte {
+	byURN := make(map[string]PrivateShard, len(priv))
+	for _, p := range priv {
+		u, err := p.AddressAndKey.URN()
+		if err != nil {
+			t.Fatalf("got error: %s", err)
+		}
+		byURN[u.String()] = p
+	}
+	r, err := Decrypt(priv[rootIdx], s)
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	}
+	for len(r.ToFetch()) > 0 {
+		var fetched []PrivateShard
+		for _, u := range r.ToFetch() {
+			p, ok := byURN[u.String()]
+			if !ok {
+				t.Fatalf("missing shard %s", u)
+			}
+			fetched = append(fetched, p)
+		}
+		r, err = DecryptFetchedResult(r, fetched, s)
+		if err != nil {
+			t.Fatalf("got decrypt fetched error: %s", err)
+		}
+	}
+	return r.Content()
+}
+
+func TestEncryptReader(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name        string
+		len         int
+		expectCount int
+	}{
+		{
+			name:        "Empty",
+			len:         0,
+			expectCount: 1,
+		},
+		{
+			name:        "Small",
+			len:         13,
+			expectCount: 1,
+		},
+		{
+			name:        "Exactly One Chunk",
+			len:         n,
+			expectCount: 1,
+		},
+		{
+			name:        "One Past A Chunk",
+			len:         n + 1,
+			expectCount: 3,
+		},
+		{
+			name:        "Several Chunks",
+			len:         3*n + 100,
+			expectCount: 5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			} else if len(priv) != test.expectCount {
+				t.Fatalf("got %d shards, want %d", len(priv), test.expectCount)
+			} else if rootIdx != len(priv)-1 {
+				t.Fatalf("got root index %d, want %d", rootIdx, len(priv)-1)
+			}
+			for i, p := range priv {
+				if len(p.Content) != constChunkSize {
+					t.Errorf("got shard %d len %d, want %d", i, len(p.Content), constChunkSize)
+				}
+			}
+
+			var streamed []PrivateShard
+			root, err := EncryptReader(iotest.HalfReader(bytes.NewReader(plain)), testSymmKey, PROTO_ZERO_SUITE, ShardSinkFunc(func(p PrivateShard) error {
+				streamed = append(streamed, p)
+				return nil
+			}))
+			if err != nil {
+				t.Fatalf("got encrypt reader error: %s", err)
+			} else if len(streamed) != len(priv) {
+				t.Fatalf("got %d streamed shards, want %d", len(streamed), len(priv))
+			} else if root.AddressAndKey.String() != priv[rootIdx].AddressAndKey.String() {
+				t.Errorf("got root %s, want %s", root.AddressAndKey, priv[rootIdx].AddressAndKey)
+			}
+			for i := range priv {
+				if !bytes.Equal(streamed[i].Content, priv[i].Content) {
+					t.Errorf("got different content for shard %d", i)
+				}
+			}
+
+			if got := decryptShards(t, rootIdx, priv, PROTO_ZERO_SUITE); !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestEncryptVariadicChunks(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name        string
+		len         int
+		expectSizes []int
+	}{
+		{
+			name:        "Tiny",
+			len:         40,
+			expectSizes: []int{1024},
+		},
+		{
+			name:        "Small",
+			len:         1500,
+			expectSizes: []int{2048},
+		},
+		{
+			name:        "Largest Single",
+			len:         n,
+			expectSizes: []int{constChunkSize},
+		},
+		{
+			name:        "Small Remainder",
+			len:         n + 10,
+			expectSizes: []int{constChunkSize, 1024, 1024},
+		},
+		{
+			name:        "Large Remainder",
+			len:         2*n + 9000,
+			expectSizes: []int{constChunkSize, constChunkSize, 16384, 1024},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := EncryptOptions{VariadicChunks: true}.Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			} else if len(priv) != len(test.expectSizes) {
+				t.Fatalf("got %d shards, want %d", len(priv), len(test.expectSizes))
+			}
+			for i, p := range priv {
+				if len(p.Content) != test.expectSizes[i] {
+					t.Errorf("got shard %d len %d, want %d", i, len(p.Content), test.expectSizes[i])
+				}
+			}
+			if got := decryptShards(t, rootIdx, priv, PROTO_ZERO_SUITE); !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestEncryptAEAD(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize-chacha20poly1305.Overhead)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name     string
+		len      int
+		variadic bool
+	}{
+		{
+			name: "Empty",
+			len:  0,
+		},
+		{
+			name: "Exactly One Chunk",
+			len:  n,
+		},
+		{
+			name: "Several Chunks",
+			len:  3*n + 100,
+		},
+		{
+			name:     "Variadic",
+			len:      n + 10,
+			variadic: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := EncryptOptions{VariadicChunks: test.variadic}.Encrypt(plain, testSymmKey, PROTO_ZERO_AEAD_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			for i, p := range priv {
+				if !isAllowedChunkSize(len(p.Content)) {
+					t.Errorf("got shard %d len %d, which is not allowed", i, len(p.Content))
+				}
+			}
+			if got := decryptShards(t, rootIdx, priv, PROTO_ZERO_AEAD_SUITE); !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestDecryptAEADTampered(t *testing.T) {
+	_, priv, err := Encrypt(testContent(13), testSymmKey, PROTO_ZERO_AEAD_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	// Readdress the tampered content, so that only authentication can
+	// detect it.
+	tampered := make([]byte, len(priv[0].Content))
+	copy(tampered, priv[0].Content)
+	tampered[7] ^= 1
+	idsc, err := NewIDSC(PROTO_ZERO_AEAD_SUITE, tampered, testSymmKey)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	_, err = Decrypt(PrivateShard{Content: tampered, AddressAndKey: idsc}, PROTO_ZERO_AEAD_SUITE)
+	if err != ErrAuthentication {
+		t.Errorf("got %v, want %v", err, ErrAuthentication)
+	}
+
+	enc, err := encryptWriteKey([]byte("write key"), testSymmKey, PROTO_ZERO_AEAD_SUITE)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	enc[0] ^= 1
+	if _, err = decryptWriteKey(enc, testSymmKey, PROTO_ZERO_AEAD_SUITE); err != ErrAuthentication {
+		t.Errorf("got %v, want %v", err, ErrAuthentication)
+	}
+
+	enc, iv, err := encryptURN([]byte("urn:sha256d:abc"), testSymmKey, PROTO_ZERO_AEAD_SUITE)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	enc[0] ^= 1
+	if _, err = decryptURN(enc, iv, testSymmKey, PROTO_ZERO_AEAD_SUITE); err != ErrAuthentication {
+		t.Errorf("got %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestEncryptWorkers(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	plain := testContent(600*n + 1)
+	expectRoot, expect, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	for _, workers := range []int{1, 2, 7, 32} {
+		t.Run(fmt.Sprintf("%d Workers", workers), func(t *testing.T) {
+			opts := EncryptOptions{Workers: workers}
+			rootIdx, priv, err := opts.Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			} else if rootIdx != expectRoot || len(priv) != len(expect) {
+				t.Fatalf("got root %d of %d shards, want root %d of %d", rootIdx, len(priv), expectRoot, len(expect))
+			}
+			for i := range priv {
+				if priv[i].AddressAndKey.String() != expect[i].AddressAndKey.String() {
+					t.Fatalf("got shard %d %s, want %s", i, priv[i].AddressAndKey, expect[i].AddressAndKey)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptWorkersSinkError(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	errSink := errors.New("sink is full")
+	puts := 0
+	_, err = EncryptOptions{Workers: 4}.EncryptReader(bytes.NewReader(testContent(20*n)), testSymmKey, PROTO_ZERO_SUITE, ShardSinkFunc(func(p PrivateShard) error {
+		if puts == 5 {
+			return errSink
+		}
+		puts++
+		return nil
+	}))
+	if err != errSink {
+		t.Errorf("got error %v, want %v", err, errSink)
+	} else if puts != 5 {
+		t.Errorf("got %d shards put, want 5", puts)
+	}
+}
@@ -3,12 +3,157 @@ package dshards
 import (
 	"bytes"
 	"fmt"
+	"hash"
 	"strings"
 
 	"github.com/cjslep/syrup"
 )
 
-func decode(b []byte) (r *Result, err error) {
+// decodedShard is the decoded plaintext of a single datashard.
+type decodedShard struct {
+	isManifest bool
+	// If a manifest, whether it is a legacy manifest, whose content is the
+	// (possibly partial) concatenation of URN strings.
+	legacy bool
+	// If a manifest, the length of the content beneath it and its level
+	// in the manifest tree.
+	contentLen int64
+	level      int
+	// If a manifest, the URNs it lists, all of which use hash.
+	hash Hash
+	urns []URN
+	// If not a manifest, the raw content.
+	content []byte
+}
+
+// tag is the type of the datashard.
+func (d decodedShard) tag() string {
+	if !d.isManifest {
+		return kRaw
+	} else if d.legacy {
+		return kManifest
+	}
+	return kHashManifest
+}
+
+// decodeRoot decodes the root datashard, which is either the entire content
+// or the root of the manifest tree.
+func decodeRoot(b []byte, s Suite) (r *Result, err error) {
+	var d decodedShard
+	d, err = decodeShard(b)
+	if err != nil {
+		return
+	}
+	r = &Result{}
+	if !d.isManifest {
+		r.content = d.content
+		return
+	} else if d.legacy {
+		return decodeLegacyRoot(d)
+	}
+	var shape treeShape
+	shape, err = newTreeShape(s, d.contentLen)
+	if err != nil {
+		return
+	} else if h := shape.height(); h == 0 {
+		err = fmt.Errorf("malformed datashard: root %q for content len %d that fits in a single datashard", kHashManifest, d.contentLen)
+		return
+	} else if d.level != h {
+		err = fmt.Errorf("malformed datashard: root %q has level %d but expected %d", kHashManifest, d.level, h)
+		return
+	}
+	r.fetch, err = decodeManifest(d, d.level, 0, shape)
+	if err != nil {
+		return
+	}
+	r.contentLen = d.contentLen
+	r.level = d.level - 1
+	return
+}
+
+// decodeLegacyRoot decodes the root of a legacy manifest tree, which does not
+// record the levels beneath it.
+func decodeLegacyRoot(d decodedShard) (r *Result, err error) {
+	if d.contentLen < 0 {
+		err = fmt.Errorf("malformed datashard: negative content len %d", d.contentLen)
+		return
+	}
+	r = &Result{
+		contentLen: d.contentLen,
+		legacy:     true,
+	}
+	r.fetch, err = decodeManifestURNs(d.content)
+	return
+}
+
+// decodeLegacyManifests obtains the URNs listed by the parts of a legacy
+// manifest, which were too large for a single datashard. Only the root
+// manifest records the length of the content, so the length recorded by each
+// part is ignored.
+func decodeLegacyManifests(decoded []decodedShard) (urns []URN, err error) {
+	var content []byte
+	for i, d := range decoded {
+		if !d.legacy {
+			err = fmt.Errorf("malformed datashard: decrypting %dth fetched result expected %q but got %q", i, kManifest, d.tag())
+			return
+		}
+		content = append(content, d.content...)
+	}
+	return decodeManifestURNs(content)
+}
+
+// decodeManifestURNs splits the concatenated URNs of a legacy manifest.
+func decodeManifestURNs(b []byte) (urns []URN, err error) {
+	ss := strings.Split(string(b), urnPrefix+urnDelim)
+	// Content begins with the delimiter, leaving an empty first element.
+	if ss[0] != "" {
+		err = fmt.Errorf("decoded datashard manifest entry content does not begin with %q", urnPrefix+urnDelim)
+		return
+	}
+	ss = ss[1:]
+	if len(ss) == 0 {
+		err = fmt.Errorf("decoded datashard manifest entry lists no urns")
+		return
+	}
+	urns = make([]URN, len(ss))
+	for i, s := range ss {
+		urns[i], err = ParseURN(fmt.Sprintf("%s%s%s", urnPrefix, urnDelim, s))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decodeManifestHashes obtains the URNs of the hashes listed by a manifest.
+func decodeManifestHashes(h Hash, v interface{}) (urns []URN, err error) {
+	var hh hash.Hash
+	hh, err = h.Hash()
+	if err != nil {
+		return
+	}
+	vs, ok := v.([]interface{})
+	if !ok {
+		err = fmt.Errorf("decoded datashard manifest entry hashes invalid type: %T", v)
+		return
+	}
+	urns = make([]URN, len(vs))
+	for i, e := range vs {
+		if b, ok := e.([]byte); !ok {
+			err = fmt.Errorf("decoded datashard manifest entry %dth hash invalid type: %T", i, e)
+			return
+		} else if len(b) != hh.Size() {
+			err = fmt.Errorf("decoded datashard manifest entry %dth hash len %d but %q is %d", i, len(b), h, hh.Size())
+			return
+		} else {
+			urns[i] = URN{dhash: h, hash: b}
+		}
+	}
+	return
+}
+
+// decodeShard decodes the plaintext of a single datashard.
+func decodeShard(b []byte) (d decodedShard, err error) {
 	buf := bytes.NewBuffer(b)
 	var v interface{}
 	err = syrup.NewDecoder(syrup.NewPrototypeEncoding(), buf).Decode(&v)
@@ -28,10 +173,17 @@ func decode(b []byte) (r *Result, err error) {
 			err = fmt.Errorf("decoded datashard 0th element not string: %T", vs[0])
 			return
 		} else {
-			if s == kManifest {
+			if s == kHashManifest {
 				isManifest = true
+				if len(vs) != 6 {
+					err = fmt.Errorf("decoded manifest datashard len != 6: %d", len(vs))
+					return
+				}
+			} else if s == kManifest {
+				isManifest = true
+				d.legacy = true
 				if len(vs) != 4 {
-					err = fmt.Errorf("decoded manifest datashard len != 4: %d", len(vs))
+					err = fmt.Errorf("decoded legacy manifest datashard len != 4: %d", len(vs))
 					return
 				}
 			} else if s == kRaw {
@@ -46,33 +198,52 @@ func decode(b []byte) (r *Result, err error) {
 			}
 		}
 
-		r = &Result{}
-		if isManifest {
+		d.isManifest = isManifest
+		if d.legacy {
 			if l, ok := vs[2].(int64); !ok {
 				err = fmt.Errorf("decoded datashard manifest entry content len invalid type: %T", vs[2])
 				return
 			} else {
-				r.contentLen = l
+				d.contentLen = l
 			}
 			if b, ok := vs[3].([]byte); !ok {
 				err = fmt.Errorf("decoded datashard manifest entry content invalid type: %T", vs[3])
 				return
 			} else {
-				ss := strings.Split(string(b), urnPrefix+urnDelim)
-				r.fetch = make([]URN, len(ss))
-				for i, s := range ss {
-					r.fetch[i], err = ParseURN(fmt.Sprintf("%s%s%s", urnPrefix, urnDelim, s))
-					if err != nil {
-						return
-					}
-				}
+				d.content = b
+			}
+		} else if isManifest {
+			if l, ok := vs[2].(int64); !ok {
+				err = fmt.Errorf("decoded datashard manifest entry content len invalid type: %T", vs[2])
+				return
+			} else {
+				d.contentLen = l
+			}
+			if l, ok := vs[3].(int64); !ok {
+				err = fmt.Errorf("decoded datashard manifest entry level invalid type: %T", vs[3])
+				return
+			} else if l < 1 || l > maxManifestLevel {
+				err = fmt.Errorf("decoded datashard manifest entry level out of range: %d", l)
+				return
+			} else {
+				d.level = int(l)
+			}
+			if h, ok := vs[4].(string); !ok {
+				err = fmt.Errorf("decoded datashard manifest entry hash invalid type: %T", vs[4])
+				return
+			} else {
+				d.hash = Hash(h)
+			}
+			d.urns, err = decodeManifestHashes(d.hash, vs[5])
+			if err != nil {
+				return
 			}
 		} else {
 			if b, ok := vs[1].([]byte); !ok {
 				err = fmt.Errorf("decoded datashard raw entry content invalid type: %T", vs[1])
 				return
 			} else {
-				r.content = b
+				d.content = b
 			}
 
 		}
@@ -0,0 +1,90 @@
+package dshards
+
+import (
+	"testing"
+)
+
+// addDecodingSeeds adds encoded content and manifests to the seed corpus.
+func addDecodingSeeds(f *testing.F) {
+	s := Suite(testTreeSuiteName)
+	shape, err := newTreeShape(s, 0)
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	raw, err := encodeChunk([]interface{}{kRaw}, []byte("hello"), 64)
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	f.Add(raw)
+	f.Add(raw[:len(raw)/2])
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	for _, m := range []manifest{
+		{urns: []URN{u, u}, size: shape.chunkLen + 1, level: 1},
+		{urns: []URN{u, u}, size: shape.fanOut*shape.chunkLen + 1, level: 2},
+		{urns: []URN{u}, size: 1, level: 1},
+	} {
+		b, err := m.Encode(SHA256D, true, true, testTreeOverhead)
+		if err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+		f.Add(b)
+	}
+	empty, err := encode([]interface{}{kHashManifest, constChunkSize, int64(1), 1, string(SHA256D)}, [][]byte{})
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	f.Add(empty)
+	legacy, err := encode([]interface{}{kManifest, constChunkSize, shape.chunkLen + 1}, []byte(u.String()+u.String()))
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	f.Add(legacy)
+}
+
+func FuzzDecodeShard(f *testing.F) {
+	addDecodingSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d, err := decodeShard(b)
+		if err != nil {
+			return
+		} else if d.isManifest && !d.legacy && (d.level < 1 || d.level > maxManifestLevel) {
+			t.Errorf("got manifest level %d", d.level)
+		}
+		for _, u := range d.urns {
+			if u.dhash != d.hash {
+				t.Errorf("got %q urn in %q manifest", u.dhash, d.hash)
+			}
+		}
+	})
+}
+
+func FuzzDecodeRoot(f *testing.F) {
+	addDecodingSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, s := range []Suite{PROTO_ZERO_SUITE, testTreeSuiteName} {
+			r, err := decodeRoot(b, s)
+			if err != nil {
+				continue
+			} else if r.fetch == nil {
+				continue
+			} else if r.legacy {
+				// Legacy manifests do not record the levels beneath.
+				if len(r.fetch) == 0 || r.contentLen < 0 {
+					t.Errorf("got legacy root listing %d urns of len %d", len(r.fetch), r.contentLen)
+				}
+				continue
+			}
+			shape, err := newTreeShape(s, r.contentLen)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if r.level != shape.height()-1 {
+				t.Errorf("got root listing level %d, want %d", r.level, shape.height()-1)
+			} else if int64(len(r.fetch)) != shape.count(r.level) {
+				t.Errorf("got root listing %d urns, want %d", len(r.fetch), shape.count(r.level))
+			}
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package dshards
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dirStoreTempPrefix = ".tmp-"
+	dirStoreHistoryDir = "history"
+)
+
+var _ HistoryStore = new(DirStore)
+
+// DirStore is a HistoryStore that keeps each Datashard as a file on disk. The
+// file is named after the base64 encoding of the URN's hash, in a subdirectory
+// named after the URN's hash algorithm:
+//
+//	<dir>/sha256d/X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo
+//
+// Histories are kept the same way by their keydata URN, under a "history"
+// subdirectory:
+//
+//	<dir>/history/sha256d/gl6qBg6i3dc5dz9cylxPcxIWn4SgLdTxWFzyqtwIljk
+//
+// Files are written to a temporary file and atomically renamed into place, so
+// a Datashard or History is never observed partially written.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a DirStore rooted at the directory, which is created
+// when the first Datashard is put.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// path determines the file in which the Datashard at the URN is stored.
+func (d *DirStore) path(u URN) string {
+	return filepath.Join(d.dir, string(u.dhash), base64.RawURLEncoding.EncodeToString(u.hash))
+}
+
+// historyPath determines the file in which the History for the keydata URN is
+// stored.
+func (d *DirStore) historyPath(keyData URN) string {
+	return filepath.Join(d.dir, dirStoreHistoryDir, string(keyData.dhash), base64.RawURLEncoding.EncodeToString(keyData.hash))
+}
+
+func (d *DirStore) Put(ctx context.Context, p PublicShard) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeFileAtomic(d.path(p.Address), p.Content)
+}
+
+// writeFileAtomic writes to a temporary file before renaming it to dst.
+func writeFileAtomic(dst string, b []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return
+	}
+	var f *os.File
+	f, err = ioutil.TempFile(filepath.Dir(dst), dirStoreTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(b); err != nil {
+		return
+	} else if err = f.Sync(); err != nil {
+		return
+	} else if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+func (d *DirStore) Get(ctx context.Context, u URN) (p PublicShard, err error) {
+	p.Content, err = d.Fetch(ctx, u)
+	if err != nil {
+		return
+	}
+	p.Address = u
+	return
+}
+
+func (d *DirStore) Fetch(ctx context.Context, u URN) (b []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	b, err = ioutil.ReadFile(d.path(u))
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (d *DirStore) Has(ctx context.Context, u URN) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(d.path(u))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *DirStore) Delete(ctx context.Context, u URN) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := os.Remove(d.path(u))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List obtains the URNs of all stored Datashards. Files that are not named
+// after a URN, such as in-progress writes, are skipped.
+func (d *DirStore) List(ctx context.Context) (urns []URN, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var dirs []os.FileInfo
+	dirs, err = ioutil.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		dh, errH := toHash(dir.Name())
+		if errH != nil {
+			continue
+		}
+		var files []os.FileInfo
+		files, err = ioutil.ReadDir(filepath.Join(d.dir, dir.Name()))
+		if err != nil {
+			return
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), dirStoreTempPrefix) {
+				continue
+			}
+			h, errD := base64.RawURLEncoding.DecodeString(f.Name())
+			if errD != nil {
+				continue
+			}
+			urns = append(urns, URN{dhash: dh, hash: h})
+		}
+	}
+	return
+}
+
+func (d *DirStore) FetchHistory(ctx context.Context, keyData URN) (b []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	b, err = ioutil.ReadFile(d.historyPath(keyData))
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (d *DirStore) PutHistory(ctx context.Context, keyData URN, b []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeFileAtomic(d.historyPath(keyData), b)
+}
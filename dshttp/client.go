@@ -0,0 +1,220 @@
+package dshttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjslep/dshards"
+)
+
+const (
+	// DefaultMaxConcurrency is how many Datashards a Client fetches at once
+	// by default.
+	DefaultMaxConcurrency = 8
+	// DefaultMaxRetries is how many times a Client retries a request after
+	// a server error by default.
+	DefaultMaxRetries = 3
+	// DefaultBackoff is the delay before a Client first retries a request
+	// by default.
+	DefaultBackoff = 100 * time.Millisecond
+)
+
+var _ dshards.BatchFetcher = new(Client)
+
+// Client fetches and puts Datashards on a remote server speaking the protocol
+// served by a Handler. The content of every fetched Datashard is verified
+// against its URN.
+//
+// A Client is a dshards.BatchFetcher, so dshards.DecryptAll fetches each
+// manifest's Datashards concurrently. It is not a dshards.Store, since the
+// protocol neither lists nor deletes Datashards.
+type Client struct {
+	// MaxConcurrency limits how many Datashards FetchAll fetches at once.
+	MaxConcurrency int
+	// MaxRetries is how many times a request is retried after the server
+	// responds with a 5xx status.
+	MaxRetries int
+	// Backoff is the delay before the first retry, which doubles before
+	// each subsequent retry.
+	Backoff time.Duration
+
+	base string
+	hc   *http.Client
+}
+
+// NewClient creates a Client of the server at the base URL, with the default
+// limits. If hc is nil, http.DefaultClient is used.
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{
+		MaxConcurrency: DefaultMaxConcurrency,
+		MaxRetries:     DefaultMaxRetries,
+		Backoff:        DefaultBackoff,
+		base:           strings.TrimSuffix(baseURL, "/"),
+		hc:             hc,
+	}
+}
+
+// Fetch obtains the encrypted content of the Datashard at the URN, returning
+// dshards.ErrNotFound if the server does not have it, or a
+// *dshards.ErrHashMismatch if the content does not match the URN.
+func (c *Client) Fetch(ctx context.Context, u dshards.URN) (b []byte, err error) {
+	return c.fetch(ctx, u, 0)
+}
+
+// fetch obtains the encrypted content of the Datashard at the URN, which is
+// the ith of those being fetched.
+func (c *Client) fetch(ctx context.Context, u dshards.URN, i int) (b []byte, err error) {
+	var status int
+	status, b, err = c.do(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return
+	} else if status == http.StatusNotFound {
+		err = dshards.ErrNotFound
+		return
+	} else if status != http.StatusOK {
+		err = fmt.Errorf("dshttp: fetching %s: %d %s", u, status, http.StatusText(status))
+		return
+	}
+	var ok bool
+	ok, err = u.Matches(b)
+	if err != nil {
+		return
+	} else if !ok {
+		err = &dshards.ErrHashMismatch{URN: u, Index: i}
+	}
+	return
+}
+
+// FetchAll obtains the encrypted content of the Datashards at the URNs, in the
+// same order, such as those listed by a dshards.Result's ToFetch. At most
+// MaxConcurrency are fetched at once. The first error stops the remaining
+// fetches. Content that does not match its URN is a *dshards.ErrHashMismatch
+// naming its position.
+func (c *Client) FetchAll(ctx context.Context, urns []dshards.URN) (contents [][]byte, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	n := c.MaxConcurrency
+	if n <= 0 {
+		n = 1
+	}
+	contents = make([][]byte, len(urns))
+	var once sync.Once
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+	for i, u := range urns {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, u dshards.URN) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b, ferr := c.fetch(ctx, u, i)
+			if ferr != nil {
+				once.Do(func() {
+					err = ferr
+					cancel()
+				})
+				return
+			}
+			contents[i] = b
+		}(i, u)
+	}
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		contents = nil
+	}
+	return
+}
+
+// Has determines whether the server has the Datashard at the URN.
+func (c *Client) Has(ctx context.Context, u dshards.URN) (bool, error) {
+	status, _, err := c.do(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("dshttp: checking %s: %d %s", u, status, http.StatusText(status))
+	}
+}
+
+// Put stores the Datashard on the server.
+func (c *Client) Put(ctx context.Context, p dshards.PublicShard) error {
+	status, _, err := c.do(ctx, http.MethodPut, p.Address, p.Content)
+	if err != nil {
+		return err
+	} else if status != http.StatusCreated && status != http.StatusOK && status != http.StatusNoContent {
+		return fmt.Errorf("dshttp: putting %s: %d %s", p.Address, status, http.StatusText(status))
+	}
+	return nil
+}
+
+// do sends the request for the Datashard at the URN, retrying with backoff
+// while the server responds with a 5xx status. At most MaxShardSize bytes of
+// a successful response body are accepted.
+func (c *Client) do(ctx context.Context, method string, u dshards.URN, body []byte) (status int, b []byte, err error) {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		status, b, err = c.doOnce(ctx, method, u, body)
+		if err != nil || status < 500 || attempt >= c.MaxRetries {
+			return
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, method string, u dshards.URN, body []byte) (status int, b []byte, err error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, method, c.base+ShardPath(u), r)
+	if err != nil {
+		return
+	}
+	var resp *http.Response
+	resp, err = c.hc.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	b, err = ioutil.ReadAll(io.LimitReader(resp.Body, MaxShardSize+1))
+	if err != nil {
+		return
+	} else if status == http.StatusOK && len(b) > MaxShardSize {
+		err = fmt.Errorf("dshttp: response for %s exceeds %d bytes", u, MaxShardSize)
+	}
+	return
+}
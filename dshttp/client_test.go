@@ -0,0 +1,204 @@
+package dshttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjslep/dshards"
+)
+
+var testSymmKey = dshards.SymmetricKey(bytes.Repeat([]byte{0x42}, 32))
+
+// newTestClient creates a Client of the server that retries without delay.
+func newTestClient(srv *httptest.Server) *Client {
+	c := NewClient(srv.URL+"/", srv.Client())
+	c.Backoff = time.Millisecond
+	return c
+}
+
+// countingHandler wraps a Handler, failing the first requests with a 503 and
+// recording the most requests handled at once.
+type countingHandler struct {
+	h *Handler
+
+	mu          sync.Mutex
+	failures    int
+	inFlight    int
+	maxInFlight int
+	requests    int
+}
+
+func (c *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.requests++
+	if c.failures > 0 {
+		c.failures--
+		c.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	time.Sleep(time.Millisecond)
+	c.h.ServeHTTP(w, r)
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(NewHandler(dshards.NewMemoryStore()))
+	defer srv.Close()
+	c := newTestClient(srv)
+
+	plain := bytes.Repeat([]byte("datashards over http "), 20000)
+	root, err := dshards.EncryptReader(bytes.NewReader(plain), testSymmKey, dshards.PROTO_ZERO_SUITE, dshards.ShardSinkFunc(func(p dshards.PrivateShard) error {
+		pub, err := p.PublicShard()
+		if err != nil {
+			return err
+		}
+		return c.Put(ctx, pub)
+	}))
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	u, err := root.AddressAndKey.URN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	if ok, err := c.Has(ctx, u); err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if !ok {
+		t.Errorf("got no root datashard on the server")
+	}
+	got, err := dshards.DecryptAll(ctx, root.AddressAndKey, c)
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	} else if !bytes.Equal(got, plain) {
+		t.Errorf("got len %d, want len %d", len(got), len(plain))
+	}
+
+	missing, _ := newTestShard(t, 10)
+	if ok, err := c.Has(ctx, missing); err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if ok {
+		t.Errorf("got missing datashard on the server")
+	}
+	if _, err = c.Fetch(ctx, missing); err != dshards.ErrNotFound {
+		t.Errorf("got error %v, want %v", err, dshards.ErrNotFound)
+	}
+}
+
+func TestClientFetchAll(t *testing.T) {
+	ctx := context.Background()
+	st := dshards.NewMemoryStore()
+	h := &countingHandler{h: NewHandler(st)}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c := newTestClient(srv)
+	c.MaxConcurrency = 3
+
+	urns := make([]dshards.URN, 20)
+	contents := make([][]byte, len(urns))
+	for i := range urns {
+		urns[i], contents[i] = newTestShard(t, i+1)
+		if err := st.Put(ctx, dshards.PublicShard{Content: contents[i], Address: urns[i]}); err != nil {
+			t.Fatalf("got error: %s", err)
+		}
+	}
+	got, err := c.FetchAll(ctx, urns)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	for i := range contents {
+		if !bytes.Equal(got[i], contents[i]) {
+			t.Errorf("got len %d at %d, want len %d", len(got[i]), i, len(contents[i]))
+		}
+	}
+	if h.maxInFlight > c.MaxConcurrency {
+		t.Errorf("got %d requests at once, want at most %d", h.maxInFlight, c.MaxConcurrency)
+	}
+
+	missing, _ := newTestShard(t, 100)
+	if _, err = c.FetchAll(ctx, append(urns, missing)); err != dshards.ErrNotFound {
+		t.Errorf("got error %v, want %v", err, dshards.ErrNotFound)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	ctx := context.Background()
+	st := dshards.NewMemoryStore()
+	u, b := newTestShard(t, 100)
+	if err := st.Put(ctx, dshards.PublicShard{Content: b, Address: u}); err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name           string
+		failures       int
+		expectErr      bool
+		expectRequests int
+	}{
+		{
+			name:           "Recovers",
+			failures:       DefaultMaxRetries,
+			expectRequests: DefaultMaxRetries + 1,
+		},
+		{
+			name:           "Gives Up",
+			failures:       DefaultMaxRetries + 1,
+			expectErr:      true,
+			expectRequests: DefaultMaxRetries + 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &countingHandler{h: NewHandler(st), failures: test.failures}
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+			got, err := newTestClient(srv).Fetch(ctx, u)
+			if test.expectErr && err == nil {
+				t.Errorf("got no error")
+			} else if !test.expectErr && err != nil {
+				t.Errorf("got error: %s", err)
+			} else if !test.expectErr && !bytes.Equal(got, b) {
+				t.Errorf("got len %d, want len %d", len(got), len(b))
+			}
+			if h.requests != test.expectRequests {
+				t.Errorf("got %d requests, want %d", h.requests, test.expectRequests)
+			}
+		})
+	}
+}
+
+func TestClientMismatch(t *testing.T) {
+	u, _ := newTestShard(t, 100)
+	_, other := newTestShard(t, 200)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(other)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+	var mismatch *dshards.ErrHashMismatch
+	if _, err := c.Fetch(context.Background(), u); !errors.As(err, &mismatch) {
+		t.Errorf("got error %v, want a hash mismatch", err)
+	} else if mismatch.URN.String() != u.String() || mismatch.Index != 0 {
+		t.Errorf("got mismatch of %s at %d, want %s at 0", mismatch.URN, mismatch.Index, u)
+	}
+	if _, err := c.FetchAll(context.Background(), []dshards.URN{u, u}); !errors.As(err, &mismatch) {
+		t.Errorf("got error %v, want a hash mismatch", err)
+	} else if mismatch.URN.String() != u.String() {
+		t.Errorf("got mismatch of %s, want %s", mismatch.URN, u)
+	}
+}
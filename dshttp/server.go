@@ -0,0 +1,133 @@
+// Package dshttp serves and fetches Datashards over HTTP.
+//
+// The protocol addresses each Datashard by its URN:
+//
+//	GET  /shard/{urn}  obtains the encrypted content of the Datashard.
+//	HEAD /shard/{urn}  determines whether the Datashard exists.
+//	PUT  /shard/{urn}  stores the encrypted content of the Datashard.
+//
+// A PUT is only accepted if the body hashes to the URN. Since a URN always
+// addresses the same content, successful responses may be cached forever.
+package dshttp
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cjslep/dshards"
+)
+
+const (
+	// MaxShardSize is the largest encrypted Datashard accepted or served.
+	MaxShardSize = 32 * 1024
+
+	// ShardPrefix is the path under which each Datashard is addressed.
+	ShardPrefix = "/shard/"
+
+	// immutableCacheControl allows caches to keep a response forever, as
+	// the content at a URN cannot change.
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+// ShardPath is the path of the Datashard at the URN.
+func ShardPath(u dshards.URN) string {
+	return ShardPrefix + u.String()
+}
+
+var _ http.Handler = new(Handler)
+
+// Handler serves the Datashards of a Store.
+type Handler struct {
+	st dshards.Store
+}
+
+// NewHandler creates a Handler serving and storing Datashards in the Store.
+func NewHandler(st dshards.Store) *Handler {
+	return &Handler{st: st}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, ShardPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	u, err := dshards.ParseURN(strings.TrimPrefix(r.URL.Path, ShardPrefix))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, u)
+	case http.MethodHead:
+		h.head(w, r, u)
+	case http.MethodPut:
+		h.put(w, r, u)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, u dshards.URN) {
+	b, err := h.st.Fetch(r.Context(), u)
+	if err == dshards.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setShardHeaders(w, u)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (h *Handler) head(w http.ResponseWriter, r *http.Request, u dshards.URN) {
+	ok, err := h.st.Has(r.Context(), u)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	setShardHeaders(w, u)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, u dshards.URN) {
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxShardSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if len(b) > MaxShardSize {
+		http.Error(w, "datashard is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	ok, err := u.Matches(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if !ok {
+		http.Error(w, "content does not match the urn", http.StatusBadRequest)
+		return
+	}
+	if err = h.st.Put(r.Context(), dshards.PublicShard{Content: b, Address: u}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// setShardHeaders sets the headers describing the Datashard at the URN, which
+// never changes.
+func setShardHeaders(w http.ResponseWriter, u dshards.URN) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", immutableCacheControl)
+	w.Header().Set("ETag", strconv.Quote(u.String()))
+}
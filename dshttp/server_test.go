@@ -0,0 +1,148 @@
+package dshttp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjslep/dshards"
+)
+
+// newTestShard creates encrypted content of the given size, and its URN.
+func newTestShard(t *testing.T, size int) (dshards.URN, []byte) {
+	b := bytes.Repeat([]byte{0xd5}, size)
+	u, err := dshards.NewURN(dshards.SHA256D, b)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	return u, b
+}
+
+func TestHandler(t *testing.T) {
+	st := dshards.NewMemoryStore()
+	srv := httptest.NewServer(NewHandler(st))
+	defer srv.Close()
+
+	stored, storedContent := newTestShard(t, 100)
+	if err := st.Put(context.Background(), dshards.PublicShard{Content: storedContent, Address: stored}); err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	missing, missingContent := newTestShard(t, 200)
+	large, largeContent := newTestShard(t, MaxShardSize+1)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         []byte
+		expectStatus int
+		expectBody   []byte
+		expectCached bool
+	}{
+		{
+			name:         "Get",
+			method:       http.MethodGet,
+			path:         ShardPath(stored),
+			expectStatus: http.StatusOK,
+			expectBody:   storedContent,
+			expectCached: true,
+		},
+		{
+			name:         "Get Missing",
+			method:       http.MethodGet,
+			path:         ShardPath(missing),
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "Head",
+			method:       http.MethodHead,
+			path:         ShardPath(stored),
+			expectStatus: http.StatusOK,
+			expectBody:   []byte{},
+			expectCached: true,
+		},
+		{
+			name:         "Head Missing",
+			method:       http.MethodHead,
+			path:         ShardPath(missing),
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "Put Mismatched",
+			method:       http.MethodPut,
+			path:         ShardPath(missing),
+			body:         storedContent,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Put Too Large",
+			method:       http.MethodPut,
+			path:         ShardPath(large),
+			body:         largeContent,
+			expectStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "Put",
+			method:       http.MethodPut,
+			path:         ShardPath(missing),
+			body:         missingContent,
+			expectStatus: http.StatusCreated,
+		},
+		{
+			name:         "Get Put",
+			method:       http.MethodGet,
+			path:         ShardPath(missing),
+			expectStatus: http.StatusOK,
+			expectBody:   missingContent,
+			expectCached: true,
+		},
+		{
+			name:         "Malformed URN",
+			method:       http.MethodGet,
+			path:         ShardPrefix + "urn:sha256d",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Unknown Path",
+			method:       http.MethodGet,
+			path:         "/history/" + stored.String(),
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "Unsupported Method",
+			method:       http.MethodDelete,
+			path:         ShardPath(stored),
+			expectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, srv.URL+test.path, bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if resp.StatusCode != test.expectStatus {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, test.expectStatus, body)
+			} else if test.expectBody != nil && !bytes.Equal(body, test.expectBody) {
+				t.Errorf("got body of len %d, want len %d", len(body), len(test.expectBody))
+			}
+			if cc := resp.Header.Get("Cache-Control"); test.expectCached && cc != immutableCacheControl {
+				t.Errorf("got Cache-Control %q, want %q", cc, immutableCacheControl)
+			} else if !test.expectCached && cc == immutableCacheControl {
+				t.Errorf("got immutable Cache-Control on a %d response", resp.StatusCode)
+			}
+		})
+	}
+}
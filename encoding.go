@@ -3,104 +3,131 @@ package dshards
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 
 	"github.com/cjslep/syrup"
 )
 
 const (
+	// kManifest concatenates the URN strings of datashards, possibly split
+	// across several manifest chunks. It is no longer produced, but is
+	// still decoded so that existing content can be decrypted.
 	kManifest = "manifest"
-	kRaw      = "raw"
+	// kHashManifest lists the hashes of datashards in binary, along with
+	// the level of the manifest in the tree.
+	kHashManifest = "hash-manifest"
+	kRaw          = "raw"
 )
 
-// chunker are Manifest and Raw files that know how to chunk their contents into
-// multiple (if necessary) datashards-compatible byte streams.
-type chunker interface {
-	Chunk() ([][]byte, error)
-}
-
+// manifest lists the URNs of the datashards one level beneath it in the
+// manifest tree, and encodes itself into a single datashards-compatible chunk.
 type manifest struct {
 	urns []URN
+	// size is the length of the content beneath the manifest.
+	size int64
+	// level is the height of the manifest in the tree. The URNs of a level
+	// 1 manifest are of content, otherwise they are of manifests one level
+	// lower.
+	level int
 }
 
-func (m manifest) Chunk() ([][]byte, error) {
-	var content []byte
-	for _, urn := range m.urns {
-		content = append(content, []byte(urn.String())...)
+// Encode encodes the manifest into a chunk, overhead bytes smaller than
+// constChunkSize. The final manifest of a level is instead padded to the
+// smallest allowed size if variadic.
+//
+// The encoded manifest lists the raw hash of each URN, all of which use the
+// hash named once beforehand:
+//
+//	["hash-manifest", <chunk-size>, <content-size>, <level>, <hash>, [<hash-bytes>...]]
+func (m manifest) Encode(hash Hash, final, variadic bool, overhead int) ([]byte, error) {
+	content := make([][]byte, len(m.urns))
+	for i, urn := range m.urns {
+		if urn.dhash != hash {
+			return nil, fmt.Errorf("dshards manifest of %q hashes cannot list %q urn", hash, urn.dhash)
+		}
+		content[i] = urn.hash
 	}
-	// "manifest", <chunk-size>, <file-size>
-	return chunk([]interface{}{kManifest, constChunkSize, len(content)}, content)
-}
-
-type raw struct {
-	content []byte
-}
-
-func (r raw) Chunk() ([][]byte, error) {
-	return chunk([]interface{}{kRaw}, r.content)
+	eachChunk := []interface{}{kHashManifest, constChunkSize, m.size, m.level, string(hash)}
+	if final {
+		return encodeFinalChunk(eachChunk, content, variadic, overhead)
+	}
+	return encodeChunk(eachChunk, content, constChunkSize-overhead)
 }
 
-// Constant Chunking -- in use
+// Constant Chunking
 
 const (
 	constChunkSize = 32 * 1024 // 32 Kibibytes
 )
 
-func chunk(eachChunk []interface{}, content []byte) (o [][]byte, err error) {
-	var buf bytes.Buffer
-
-	// 1. Determine byte overhead.
-	err = syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(eachChunk)
+// chunkCapacity determines the largest amount of content that can follow the
+// eachChunk prefix while keeping the encoded chunk within size bytes.
+func chunkCapacity(eachChunk []interface{}, size int) (n int, err error) {
+	var b []byte
+	b, err = encode(eachChunk, []byte{})
 	if err != nil {
 		return
 	}
-	overhead := buf.Len()
-	buf.Reset()
-
-	// 2. Chunk (if needed)
-	for len(content) > constChunkSize-overhead {
-		toChunk := content[:constChunkSize-overhead]
-		content = content[constChunkSize-overhead:]
-
-		v := make([]interface{}, len(eachChunk)+1)
-		copy(v, eachChunk)
-		v[len(v)-1] = toChunk
-
-		err = syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(v)
-		if err != nil {
-			return
-		}
-
-		if buf.Len() != constChunkSize {
-			err = fmt.Errorf("dshards chunking encoded %d of %d bytes", buf.Len(), constChunkSize)
-			return
-		}
+	// Empty content is encoded with a single digit length prefix, which
+	// is not part of the fixed overhead.
+	overhead := len(b) - 1
+	n = size - overhead
+	for n > 0 && overhead+len(strconv.Itoa(n))+n > size {
+		n--
+	}
+	if n <= 0 {
+		err = fmt.Errorf("dshards chunk of %d bytes cannot hold content after %d bytes of overhead", size, overhead)
+	}
+	return
+}
 
-		res := make([]byte, constChunkSize)
-		copy(res, buf.Bytes())
-		o = append(o, res)
+// encodeChunk encodes the content after the eachChunk prefix, padding the
+// result to exactly size bytes.
+func encodeChunk(eachChunk []interface{}, content interface{}, size int) (res []byte, err error) {
+	var b []byte
+	b, err = encode(eachChunk, content)
+	if err != nil {
+		return
+	} else if len(b) > size {
+		err = fmt.Errorf("dshards chunking encoded %d of %d bytes", len(b), size)
+		return
+	}
+	res = make([]byte, size)
+	copy(res, b)
+	return
+}
 
-		buf.Reset()
+// encodeFinalChunk encodes the final chunk of content after the eachChunk
+// prefix, padding it to the smallest allowed size that fits if variadic. The
+// chunk is overhead bytes smaller than that size.
+func encodeFinalChunk(eachChunk []interface{}, content interface{}, variadic bool, overhead int) ([]byte, error) {
+	if !variadic {
+		return encodeChunk(eachChunk, content, constChunkSize-overhead)
+	}
+	b, err := encode(eachChunk, content)
+	if err != nil {
+		return nil, err
+	} else if exceedsLargestChunkSize(len(b) + overhead) {
+		return nil, fmt.Errorf("dshards chunking encoded %d bytes, exceeding the largest chunk size", len(b))
 	}
+	res := make([]byte, chunkerFn(len(b)+overhead)-overhead)
+	copy(res, b)
+	return res, nil
+}
 
-	// 3. Final chunk (<= constChunkSize-overhead), pad if needed
+// encode applies the syrup encoding to the content appended to eachChunk.
+func encode(eachChunk []interface{}, content interface{}) (b []byte, err error) {
 	v := make([]interface{}, len(eachChunk)+1)
 	copy(v, eachChunk)
 	v[len(v)-1] = content
 
+	var buf bytes.Buffer
 	err = syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(v)
-	if err != nil {
-		return
-	}
-
-	res := make([]byte, constChunkSize)
-	copy(res, buf.Bytes())
-	o = append(o, res)
-
-	buf.Reset()
+	b = buf.Bytes()
 	return
 }
 
-// Variadic Chunking -- not yet used
+// Variadic Chunking
 
 var allowedChunkSizesIncreasingOrder = []int{
 	1 * 1024,  // 1 Kibibyte
@@ -126,3 +153,14 @@ func chunkerFn(lenc int) int {
 	}
 	return allowedChunkSizesIncreasingOrder[len(allowedChunkSizesIncreasingOrder)-1]
 }
+
+// isAllowedChunkSize determines whether a datashard has one of the allowed
+// sizes.
+func isAllowedChunkSize(lenc int) bool {
+	for _, size := range allowedChunkSizesIncreasingOrder {
+		if lenc == size {
+			return true
+		}
+	}
+	return false
+}
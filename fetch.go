@@ -0,0 +1,161 @@
+package dshards
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fetcher obtains the encrypted content of a datashard by its URN. Whether it
+// comes from memory, a local file system, or a network is up to the
+// implementation.
+type Fetcher interface {
+	Fetch(ctx context.Context, u URN) ([]byte, error)
+}
+
+// HistoryFetcher is a Fetcher that also obtains the latest serialized History
+// of a mutable datashard, which is located by the URN of its keydata.
+type HistoryFetcher interface {
+	Fetcher
+	FetchHistory(ctx context.Context, keyData URN) ([]byte, error)
+}
+
+// BatchFetcher is a Fetcher that also obtains many Datashards at once, such as
+// concurrently over a network. The contents are returned in the same order as
+// the URNs.
+type BatchFetcher interface {
+	Fetcher
+	FetchAll(ctx context.Context, urns []URN) ([][]byte, error)
+}
+
+// DecryptAll fetches and decrypts the entire content at the IDSC, resolving as
+// many levels of manifests as are needed to reach the content.
+//
+// If the Fetcher is a BatchFetcher, all of the Datashards listed by a manifest
+// are fetched at once.
+//
+// All of the content is held in memory. Use NewDecryptingReader for large
+// content.
+func DecryptAll(ctx context.Context, idsc IDSC, f Fetcher) (plain []byte, err error) {
+	return DecryptOptions{}.DecryptAll(ctx, idsc, f)
+}
+
+// DecryptAll is like the package DecryptAll, using these options.
+func (o DecryptOptions) DecryptAll(ctx context.Context, idsc IDSC, f Fetcher) (plain []byte, err error) {
+	var u URN
+	u, err = idsc.URN()
+	if err != nil {
+		return
+	}
+	var root PrivateShard
+	root, err = fetchShard(ctx, f, u, idsc.symmKey, idsc.s)
+	if err != nil {
+		return
+	}
+	var r *Result
+	r, err = Decrypt(root, idsc.s)
+	if err != nil {
+		return
+	}
+	for len(r.ToFetch()) > 0 {
+		var priv []PrivateShard
+		priv, err = fetchShards(ctx, f, r.ToFetch(), idsc.symmKey, idsc.s)
+		if err != nil {
+			return
+		}
+		r, err = o.DecryptFetchedResult(r, priv, idsc.s)
+		if err != nil {
+			return
+		}
+	}
+	plain = r.Content()
+	return
+}
+
+// resolveLegacy fetches and decrypts the parts of a legacy manifest beneath
+// the Result, until it lists the datashards of content. A legacy manifest does
+// not record how many levels are beneath it, so the first datashard listed at
+// each level is decrypted to tell whether it is content.
+func resolveLegacy(ctx context.Context, f Fetcher, r *Result, key SymmetricKey, s Suite) (content *Result, err error) {
+	for level := 0; ; level++ {
+		if level > maxManifestLevel {
+			err = fmt.Errorf("malformed datashard: legacy %q has more than %d levels", kManifest, maxManifestLevel)
+			return
+		}
+		var ds decodedShard
+		ds, err = fetchDecoded(ctx, f, r.fetch[0], 0, 0, key, s)
+		if err != nil {
+			return
+		} else if !ds.isManifest {
+			break
+		}
+		var priv []PrivateShard
+		priv, err = fetchShards(ctx, f, r.fetch, key, s)
+		if err != nil {
+			return
+		}
+		r, err = DecryptFetchedResult(r, priv, s)
+		if err != nil {
+			return
+		}
+	}
+	var shape treeShape
+	shape, err = newTreeShape(s, r.contentLen)
+	if err != nil {
+		return
+	} else if n := shape.count(0); int64(len(r.fetch)) != n {
+		err = fmt.Errorf("malformed datashard: legacy %q lists %d datashards of content but expected %d", kManifest, len(r.fetch), n)
+		return
+	}
+	content = r
+	return
+}
+
+// fetchShard obtains the datashard at the URN. It is decrypted by the same
+// symmetric key as the datashard that referenced it.
+func fetchShard(ctx context.Context, f Fetcher, u URN, key SymmetricKey, s Suite) (p PrivateShard, err error) {
+	p.Content, err = f.Fetch(ctx, u)
+	if err != nil {
+		return
+	}
+	p.AddressAndKey = IDSC{
+		s:       s,
+		hash:    u.hash,
+		symmKey: key,
+	}
+	return
+}
+
+// fetchShards obtains the datashards at the URNs, all decrypted by the same
+// symmetric key. They are fetched at once if the Fetcher is a BatchFetcher.
+func fetchShards(ctx context.Context, f Fetcher, urns []URN, key SymmetricKey, s Suite) (priv []PrivateShard, err error) {
+	priv = make([]PrivateShard, len(urns))
+	bf, ok := f.(BatchFetcher)
+	if !ok {
+		for i, u := range urns {
+			priv[i], err = fetchShard(ctx, f, u, key, s)
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	var contents [][]byte
+	contents, err = bf.FetchAll(ctx, urns)
+	if err != nil {
+		return
+	} else if len(contents) != len(urns) {
+		err = fmt.Errorf("dshards: batch fetched %d of %d datashards", len(contents), len(urns))
+		return
+	}
+	for i, u := range urns {
+		priv[i] = PrivateShard{
+			Content: contents[i],
+			AddressAndKey: IDSC{
+				s:       s,
+				hash:    u.hash,
+				symmKey: key,
+			},
+		}
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package dshards
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testFetcher fetches from the encrypted content of PrivateShards.
+type testFetcher map[string][]byte
+
+func newTestFetcher(t *testing.T, priv []PrivateShard) testFetcher {
+	f := make(testFetcher, len(priv))
+	for _, p := range priv {
+		u, err := p.AddressAndKey.URN()
+		if err != nil {
+			t.Fatalf("got error: %s", err)
+		}
+		f[u.String()] = p.Content
+	}
+	return f
+}
+
+func (f testFetcher) Fetch(ctx context.Context, u URN) ([]byte, error) {
+	b, ok := f[u.String()]
+	if !ok {
+		return nil, fmt.Errorf("test fetcher missing %s", u)
+	}
+	return b, nil
+}
+
+func TestDecryptAll(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name string
+		len  int
+	}{
+		{
+			name: "Single Shard",
+			len:  42,
+		},
+		{
+			name: "One Manifest",
+			len:  2*n + 7,
+		},
+		{
+			name: "Manifest Of Manifests",
+			len:  600*n + 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			got, err := DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, newTestFetcher(t, priv))
+			if err != nil {
+				t.Fatalf("got decrypt error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestDecryptAllTampered(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	rootIdx, priv, err := Encrypt(testContent(3*n), testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	tests := []struct {
+		name        string
+		tamper      int
+		expectIndex int
+	}{
+		{
+			name:        "Root",
+			tamper:      rootIdx,
+			expectIndex: -1,
+		},
+		{
+			name:        "Content",
+			tamper:      1,
+			expectIndex: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFetcher(t, priv)
+			u, err := priv[test.tamper].AddressAndKey.URN()
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			tampered := make([]byte, len(priv[test.tamper].Content))
+			copy(tampered, priv[test.tamper].Content)
+			tampered[0] ^= 0xff
+			f[u.String()] = tampered
+
+			_, err = DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, f)
+			var mismatch *ErrHashMismatch
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("got error %v, want *ErrHashMismatch", err)
+			} else if mismatch.Index != test.expectIndex {
+				t.Errorf("got index %d, want %d", mismatch.Index, test.expectIndex)
+			} else if mismatch.URN.String() != u.String() {
+				t.Errorf("got %s, want %s", mismatch.URN, u)
+			}
+		})
+	}
+}
+
+// testBatchFetcher is a testFetcher that counts the Datashards fetched by
+// each call to FetchAll.
+type testBatchFetcher struct {
+	testFetcher
+	batches []int
+}
+
+func (f *testBatchFetcher) FetchAll(ctx context.Context, urns []URN) ([][]byte, error) {
+	f.batches = append(f.batches, len(urns))
+	contents := make([][]byte, len(urns))
+	for i, u := range urns {
+		b, err := f.Fetch(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = b
+	}
+	return contents, nil
+}
+
+func TestDecryptAllBatchFetcher(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	plain := testContent(3*n + 1)
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	f := &testBatchFetcher{testFetcher: newTestFetcher(t, priv)}
+	got, err := DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, f)
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	} else if !bytes.Equal(got, plain) {
+		t.Errorf("got len %d, want len %d", len(got), len(plain))
+	}
+	if len(f.batches) != 1 || f.batches[0] != 4 {
+		t.Errorf("got batches %v, want [4]", f.batches)
+	}
+}
+
+func TestDecryptAllWorkers(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	plain := testContent(600*n + 1)
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	opts := DecryptOptions{Workers: 8}
+	f := newTestFetcher(t, priv)
+	got, err := opts.DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, f)
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	} else if !bytes.Equal(got, plain) {
+		t.Errorf("got len %d, want len %d", len(got), len(plain))
+	}
+
+	// The lowest tampered Datashard is reported, however the work is
+	// scheduled.
+	for _, i := range []int{40, 3, 200} {
+		u, err := priv[i].AddressAndKey.URN()
+		if err != nil {
+			t.Fatalf("got error: %s", err)
+		}
+		f[u.String()] = make([]byte, constChunkSize)
+	}
+	_, err = opts.DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, f)
+	var mismatch *ErrHashMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got error %v, want *ErrHashMismatch", err)
+	} else if mismatch.Index != 3 {
+		t.Errorf("got index %d, want 3", mismatch.Index)
+	}
+}
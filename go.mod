@@ -1,7 +1,12 @@
 module github.com/cjslep/dshards
 
-go 1.13
+go 1.18
 
 replace github.com/cjslep/syrup => /Users/cjslep/gomodules/syrup
 
-require github.com/cjslep/syrup v1.0.0
+require (
+	github.com/cjslep/syrup v1.0.0
+	golang.org/x/crypto v0.21.0
+)
+
+require golang.org/x/sys v0.18.0 // indirect
@@ -1,9 +1,17 @@
 package dshards
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"errors"
 	"fmt"
 	"hash"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
 )
 
 // Hash are datashard-supported hash algorithms for URNs.
@@ -11,35 +19,88 @@ type Hash string
 
 const (
 	SHA256D Hash = "sha256d"
+	// SHA512_256 is SHA-512/256, as specified in FIPS 180-4.
+	SHA512_256 Hash = "sha512-256"
+	// BLAKE2B_256 is BLAKE2b with a 256 bit digest, as specified in RFC
+	// 7693.
+	BLAKE2B_256 Hash = "blake2b-256"
+)
+
+var (
+	hashesMu sync.RWMutex
+	hashes   = make(map[Hash]func() hash.Hash)
 )
 
+func init() {
+	RegisterHash(SHA256D, func() hash.Hash {
+		return newDoublingHash(sha256.New)
+	})
+	RegisterHash(SHA512_256, sha512.New512_256)
+	RegisterHash(BLAKE2B_256, func() hash.Hash {
+		// Only a key longer than 64 bytes is an error.
+		h, _ := blake2b.New256(nil)
+		return h
+	})
+}
+
+// RegisterHash makes a Hash available for URNs, with a function that creates
+// a new instance of it. Like crypto.RegisterHash, it is intended to be called
+// from init.
+//
+// The name appears in URNs and as a DirStore directory, so it may not be empty
+// nor contain a ":" or a path separator. RegisterHash panics if the name is
+// invalid, if f is nil, or if the name is already registered.
+func RegisterHash(h Hash, f func() hash.Hash) {
+	if h == "" || strings.ContainsAny(string(h), urnDelim+`/\`) {
+		panic(fmt.Sprintf("dshards: invalid hash name %q", h))
+	} else if f == nil {
+		panic("dshards: RegisterHash func is nil")
+	}
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	if _, dup := hashes[h]; dup {
+		panic(fmt.Sprintf("dshards: RegisterHash called twice for hash %q", h))
+	}
+	hashes[h] = f
+}
+
 // toHash converts a string into a Hash type.
 func toHash(s string) (dsh Hash, err error) {
-	switch s {
-	case string(SHA256D):
-		dsh = SHA256D
-	default:
-		err = fmt.Errorf("unknown datashards hash %q", s)
-	}
+	dsh = Hash(s)
+	_, err = dsh.Hash()
 	return
 }
 
 // toHash interprets a Hash into a Golang Hash type.
 func (dsh Hash) Hash() (h hash.Hash, err error) {
-	switch dsh {
-	case SHA256D:
-		h = &doublingHash{sha256.New()}
-	default:
+	hashesMu.RLock()
+	f, ok := hashes[dsh]
+	hashesMu.RUnlock()
+	if !ok {
 		err = fmt.Errorf("unknown datashards hash %q", dsh)
+		return
 	}
+	h = f()
 	return
 }
 
 var _ hash.Hash = new(doublingHash)
+var _ encoding.BinaryMarshaler = new(doublingHash)
+var _ encoding.BinaryUnmarshaler = new(doublingHash)
 
-// doublingHash applies a Hash twice.
+// doublingHashMagic prefixes the marshaled state of a doublingHash.
+const doublingHashMagic = "dshd\x01"
+
+// doublingHash applies a Hash twice: the digest of the written content is
+// itself hashed by a fresh Hash.
 type doublingHash struct {
 	hash.Hash
+	newHash func() hash.Hash
+}
+
+// newDoublingHash creates a doublingHash from a Hash constructor.
+func newDoublingHash(f func() hash.Hash) *doublingHash {
+	return &doublingHash{Hash: f(), newHash: f}
 }
 
 // Sum computes the current hash. It does not modify state.
@@ -48,7 +109,32 @@ type doublingHash struct {
 // interface.
 func (d *doublingHash) Sum(b []byte) []byte {
 	once := d.Hash.Sum(nil)
-	d.Hash.Reset()
-	_, _ = d.Hash.Write(once)
-	return d.Hash.Sum(b)
+	h := d.newHash()
+	_, _ = h.Write(once)
+	return h.Sum(b)
+}
+
+// MarshalBinary saves the state of the first pass of the hash, so hashing can
+// be resumed later with UnmarshalBinary.
+func (d *doublingHash) MarshalBinary() ([]byte, error) {
+	m, ok := d.Hash.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("dshards: %T cannot be marshaled", d.Hash)
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(doublingHashMagic), b...), nil
+}
+
+// UnmarshalBinary restores the state saved by MarshalBinary.
+func (d *doublingHash) UnmarshalBinary(b []byte) error {
+	u, ok := d.Hash.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("dshards: %T cannot be unmarshaled", d.Hash)
+	} else if !bytes.HasPrefix(b, []byte(doublingHashMagic)) {
+		return errors.New("dshards: invalid doubling hash state identifier")
+	}
+	return u.UnmarshalBinary(b[len(doublingHashMagic):])
 }
@@ -0,0 +1,164 @@
+package dshards
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"testing"
+)
+
+func TestRegisterHash(t *testing.T) {
+	tests := []struct {
+		name string
+		h    Hash
+		nilF bool
+	}{
+		{
+			name: "Empty Name",
+			h:    "",
+		},
+		{
+			name: "Delimiter In Name",
+			h:    "my:hash",
+		},
+		{
+			name: "Path In Name",
+			h:    "my/hash",
+		},
+		{
+			name: "Nil Func",
+			h:    "nil-hash",
+			nilF: true,
+		},
+		{
+			name: "Duplicate",
+			h:    SHA256D,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("got no panic")
+				}
+			}()
+			f := sha256.New
+			if test.nilF {
+				f = nil
+			}
+			RegisterHash(test.h, f)
+		})
+	}
+}
+
+func TestHashRoundTrip(t *testing.T) {
+	content := testContent(300)
+	for _, h := range []Hash{SHA256D, SHA512_256, BLAKE2B_256} {
+		t.Run(string(h), func(t *testing.T) {
+			u, err := NewURN(h, content)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			parsed, err := ParseURN(u.String())
+			if err != nil {
+				t.Fatalf("got parse error: %s", err)
+			} else if parsed.String() != u.String() {
+				t.Errorf("got %s, want %s", parsed, u)
+			} else if ok, err := parsed.Matches(content); err != nil {
+				t.Errorf("got error: %s", err)
+			} else if !ok {
+				t.Errorf("got no match for %s", parsed)
+			}
+		})
+	}
+	if _, err := ParseURN("urn:md5:X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo"); err == nil {
+		t.Errorf("got no error parsing an unregistered hash")
+	}
+}
+
+// twoPassSHA256 hashes b with sha256, then hashes that digest with sha256.
+func twoPassSHA256(b []byte) []byte {
+	once := sha256.Sum256(b)
+	twice := sha256.Sum256(once[:])
+	return twice[:]
+}
+
+func TestDoublingHash(t *testing.T) {
+	content := testContent(1000)
+	tests := []struct {
+		name   string
+		pieces []int
+	}{
+		{
+			name:   "Empty",
+			pieces: []int{0},
+		},
+		{
+			name:   "One Write",
+			pieces: []int{1000},
+		},
+		{
+			name:   "Many Writes",
+			pieces: []int{1, 63, 64, 200, 672},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := SHA256D.Hash()
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			written := 0
+			for _, n := range test.pieces {
+				h.Write(content[written : written+n])
+				written += n
+				// Sum must not disturb later writes.
+				expect := twoPassSHA256(content[:written])
+				if got := h.Sum(nil); !bytes.Equal(got, expect) {
+					t.Fatalf("got %x after %d bytes, want %x", got, written, expect)
+				} else if got = h.Sum(nil); !bytes.Equal(got, expect) {
+					t.Fatalf("got %x on second sum after %d bytes, want %x", got, written, expect)
+				}
+			}
+			if got := h.Sum([]byte("prefix")); !bytes.Equal(got, append([]byte("prefix"), twoPassSHA256(content[:written])...)) {
+				t.Errorf("got %x, which does not append to the prefix", got)
+			}
+			h.Reset()
+			if got := h.Sum(nil); !bytes.Equal(got, twoPassSHA256(nil)) {
+				t.Errorf("got %x after reset, want %x", got, twoPassSHA256(nil))
+			}
+		})
+	}
+}
+
+func TestDoublingHashMarshal(t *testing.T) {
+	content := testContent(1000)
+	h, err := SHA256D.Hash()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	h.Write(content[:300])
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	}
+
+	resumed, err := SHA256D.Hash()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if err = resumed.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		t.Fatalf("got unmarshal error: %s", err)
+	}
+	resumed.Write(content[300:])
+	if got, expect := resumed.Sum(nil), twoPassSHA256(content); !bytes.Equal(got, expect) {
+		t.Errorf("got %x, want %x", got, expect)
+	}
+
+	plain := sha256.New()
+	plainState, err := plain.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	} else if err = resumed.(encoding.BinaryUnmarshaler).UnmarshalBinary(plainState); err == nil {
+		t.Errorf("got no error unmarshaling a sha256 state")
+	}
+}
@@ -2,7 +2,9 @@ package dshards
 
 import (
 	"bytes"
+	"crypto/rand"
 	"fmt"
+	"io"
 
 	"github.com/cjslep/syrup"
 )
@@ -13,10 +15,18 @@ const (
 	kHist   = "history"
 )
 
+// revisionSaltLen is the length of the random salt mixed into the key of each
+// published revision's content.
+const revisionSaltLen = 32
+
 type Revision struct {
 	n      int64
 	iv     []byte
 	encLoc []byte
+	// Random, so that revisions with the same number, such as those of
+	// racing publishers, do not share a content key. Revisions written
+	// without one lack it in their encoding.
+	salt []byte
 }
 
 type RevSig struct {
@@ -72,12 +82,16 @@ func NewHistory(s Suite, p PrivateKeyer, read SymmetricKey) *History {
 }
 
 func (r Revision) syrup() interface{} {
-	return []interface{}{
+	v := []interface{}{
 		kRev,
 		r.n,
 		r.iv,
 		r.encLoc,
 	}
+	if len(r.salt) > 0 {
+		v = append(v, r.salt)
+	}
+	return v
 }
 
 func (r Revision) signingBytes() (b []byte, err error) {
@@ -91,8 +105,8 @@ func (r Revision) signingBytes() (b []byte, err error) {
 func (r *Revision) unsyrup(v interface{}) (err error) {
 	if vs, ok := v.([]interface{}); !ok {
 		err = fmt.Errorf("revision not []interface: %T", v)
-	} else if len(vs) != 4 {
-		err = fmt.Errorf("revision not len=4: %d", len(vs))
+	} else if len(vs) != 4 && len(vs) != 5 {
+		err = fmt.Errorf("revision not len=4 or len=5: %d", len(vs))
 	} else if str, ok := vs[0].(string); !ok || str != kRev {
 		err = fmt.Errorf("revision elem[0] not string or not %q: %v", kRev, vs[0])
 	} else if n, ok := vs[1].(int64); !ok {
@@ -105,6 +119,11 @@ func (r *Revision) unsyrup(v interface{}) (err error) {
 		r.n = n
 		r.iv = iv
 		r.encLoc = encLoc
+		if len(vs) == 5 {
+			if r.salt, ok = vs[4].([]byte); !ok || len(r.salt) == 0 {
+				err = fmt.Errorf("revision elem[4] not non-empty []byte: %T", vs[4])
+			}
+		}
 	}
 	return
 }
@@ -141,7 +160,18 @@ func (h *HistoryVerifyOnly) Len() int {
 	return len(h.revsigs)
 }
 
+// checkIndex ensures the history has an ith revision.
+func (h *HistoryVerifyOnly) checkIndex(i int) error {
+	if i < 0 || i >= len(h.revsigs) {
+		return fmt.Errorf("history has no revision %d of %d", i, len(h.revsigs))
+	}
+	return nil
+}
+
 func (h *HistoryReadOnly) ReadURN(i int) (u URN, err error) {
+	if err = h.checkIndex(i); err != nil {
+		return
+	}
 	var plain []byte
 	if plain, err = decryptURN(h.revsigs[i].rev.encLoc, h.revsigs[i].rev.iv, h.readKey, h.s); err != nil {
 		return
@@ -151,9 +181,34 @@ func (h *HistoryReadOnly) ReadURN(i int) (u URN, err error) {
 	return
 }
 
+// ReadIDSC returns the capability to decrypt the content of the ith revision.
+func (h *HistoryReadOnly) ReadIDSC(i int) (c IDSC, err error) {
+	var u URN
+	if u, err = h.ReadURN(i); err != nil {
+		return
+	}
+	rev := h.revsigs[i].rev
+	c = IDSC{s: h.s, hash: u.hash, symmKey: revisionKey(h.readKey, rev.n, rev.salt)}
+	return
+}
+
+// newSalt generates the random salt of a revision about to be published.
+func newSalt() (salt []byte, err error) {
+	salt = make([]byte, revisionSaltLen)
+	_, err = io.ReadFull(rand.Reader, salt)
+	return
+}
+
 func (h *History) Write(p PublicShard) (err error) {
+	return h.write(p, nil)
+}
+
+// write appends a signed revision of the content at the PublicShard, whose key
+// was derived with the salt.
+func (h *History) write(p PublicShard, salt []byte) (err error) {
 	var r RevSig
 	r.rev.n = int64(len(h.revsigs))
+	r.rev.salt = salt
 	r.rev.encLoc, r.rev.iv, err = encryptURN([]byte(p.Address.String()), h.readKey, h.s)
 	if err != nil {
 		return
@@ -170,13 +225,15 @@ func (h *History) Write(p PublicShard) (err error) {
 }
 
 func (h *HistoryVerifyOnly) Verify(i int) (err error) {
+	if err = h.checkIndex(i); err != nil {
+		return
+	}
 	var sigb []byte
 	if sigb, err = h.revsigs[i].rev.signingBytes(); err != nil {
 		return
 	}
 
-	pub := h.p.PublicKey()
-	err = verifyRevision(&pub, sigb, h.revsigs[i].sig, h.s)
+	err = verifyRevision(h.p.PublicKey(), sigb, h.revsigs[i].sig, h.s)
 	return
 }
 
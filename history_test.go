@@ -52,6 +52,26 @@ var (
 			sig: []byte("signature3"),
 		},
 	}
+	revSigBytesSalted []byte   = []byte("[7\"history[[7\"rev-sig[8\"revisioni0e2:123:3334:salt]4:sig1][7\"rev-sig[8\"revisioni1e4:12345:11111]4:sig2]]]")
+	revSigSalted      []RevSig = []RevSig{
+		{
+			rev: Revision{
+				n:      0,
+				iv:     []byte{49, 50},
+				encLoc: []byte{51, 51, 51},
+				salt:   []byte("salt"),
+			},
+			sig: []byte("sig1"),
+		},
+		{
+			rev: Revision{
+				n:      1,
+				iv:     []byte{49, 50, 51, 52},
+				encLoc: []byte{49, 49, 49, 49, 49},
+			},
+			sig: []byte("sig2"),
+		},
+	}
 	dynLoc1    string   = "urn:sha256d:7gfqd3hDTf56FEb9i_x9_cxwgVwjUNDwldJtC9v1T8o"
 	dynLoc2    string   = "urn:sha256d:fwFIj8TIXaeiViqbH252V5L0mY3EOb5pPXhQg-Xci1c"
 	dynLoc3    string   = "urn:sha256d:E7XwTkJO2ufGW7cCc9qk5rNJPh2xTbxxDN0HMQHiP4s"
@@ -146,6 +166,12 @@ func TestUnmarshal(t *testing.T) {
 			u:      &History{},
 			expect: revSig1,
 		},
+		{
+			name:   "Salted",
+			in:     revSigBytesSalted,
+			u:      &HistoryReadOnly{},
+			expect: revSigSalted,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -200,6 +226,13 @@ func TestMarshal(t *testing.T) {
 			},
 			expect: revSigBytes1,
 		},
+		{
+			name: "Salted",
+			m: &HistoryVerifyOnly{
+				revsigs: revSigSalted,
+			},
+			expect: revSigBytesSalted,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -302,7 +335,7 @@ func TestVerify(t *testing.T) {
 			name: "Verify-Only: Verify Head",
 			v: &HistoryVerifyOnly{
 				revsigs: revSigDyn1,
-				p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+				p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 				s:       PROTO_ZERO_SUITE,
 			},
 			i: 0,
@@ -311,7 +344,7 @@ func TestVerify(t *testing.T) {
 			name: "Verify-Only: Verify Middle",
 			v: &HistoryVerifyOnly{
 				revsigs: revSigDyn1,
-				p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+				p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 				s:       PROTO_ZERO_SUITE,
 			},
 			i: 1,
@@ -320,7 +353,7 @@ func TestVerify(t *testing.T) {
 			name: "Verify-Only: Verify Tail",
 			v: &HistoryVerifyOnly{
 				revsigs: revSigDyn1,
-				p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+				p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 				s:       PROTO_ZERO_SUITE,
 			},
 			i: 2,
@@ -330,7 +363,7 @@ func TestVerify(t *testing.T) {
 			v: &HistoryReadOnly{
 				HistoryVerifyOnly: HistoryVerifyOnly{
 					revsigs: revSigDyn1,
-					p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+					p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 					s:       PROTO_ZERO_SUITE,
 				},
 			},
@@ -341,7 +374,7 @@ func TestVerify(t *testing.T) {
 			v: &HistoryReadOnly{
 				HistoryVerifyOnly: HistoryVerifyOnly{
 					revsigs: revSigDyn1,
-					p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+					p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 					s:       PROTO_ZERO_SUITE,
 				},
 			},
@@ -352,7 +385,7 @@ func TestVerify(t *testing.T) {
 			v: &HistoryReadOnly{
 				HistoryVerifyOnly: HistoryVerifyOnly{
 					revsigs: revSigDyn1,
-					p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+					p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 					s:       PROTO_ZERO_SUITE,
 				},
 			},
@@ -364,7 +397,7 @@ func TestVerify(t *testing.T) {
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
 						revsigs: revSigDyn1,
-						p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+						p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 						s:       PROTO_ZERO_SUITE,
 					},
 				},
@@ -377,7 +410,7 @@ func TestVerify(t *testing.T) {
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
 						revsigs: revSigDyn1,
-						p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+						p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 						s:       PROTO_ZERO_SUITE,
 					},
 				},
@@ -390,7 +423,7 @@ func TestVerify(t *testing.T) {
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
 						revsigs: revSigDyn1,
-						p:       EncryptedKeyData{vk: testPrivKey.PublicKey},
+						p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
 						s:       PROTO_ZERO_SUITE,
 					},
 				},
@@ -506,6 +539,25 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestOutOfRange(t *testing.T) {
+	h := &HistoryReadOnly{
+		HistoryVerifyOnly: HistoryVerifyOnly{
+			revsigs: revSigDyn1,
+			p:       EncryptedKeyData{vk: &testPrivKey.PublicKey},
+			s:       PROTO_ZERO_SUITE,
+		},
+		readKey: testSymmKey,
+	}
+	for _, i := range []int{-1, len(revSigDyn1), len(revSigDyn1) + 1} {
+		if err := h.Verify(i); err == nil {
+			t.Errorf("got no error verifying %d", i)
+		}
+		if _, err := h.ReadURN(i); err == nil {
+			t.Errorf("got no error reading %d", i)
+		}
+	}
+}
+
 func TestWrite(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -519,13 +571,13 @@ func TestWrite(t *testing.T) {
 			h: &History{
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
-						p: &DecryptedKeyData{vk: testPrivKey.PublicKey},
+						p: &DecryptedKeyData{vk: &testPrivKey.PublicKey},
 						s: PROTO_ZERO_SUITE,
 					},
 					readKey: testSymmKey,
 				},
 				priv: &DecryptedKeyData{
-					vk: testPrivKey.PublicKey,
+					vk: &testPrivKey.PublicKey,
 					wk: testPrivKey,
 				},
 			},
@@ -544,13 +596,13 @@ func TestWrite(t *testing.T) {
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
 						revsigs: revSig1,
-						p:       &DecryptedKeyData{vk: testPrivKey.PublicKey},
+						p:       &DecryptedKeyData{vk: &testPrivKey.PublicKey},
 						s:       PROTO_ZERO_SUITE,
 					},
 					readKey: testSymmKey,
 				},
 				priv: &DecryptedKeyData{
-					vk: testPrivKey.PublicKey,
+					vk: &testPrivKey.PublicKey,
 					wk: testPrivKey,
 				},
 			},
@@ -569,13 +621,13 @@ func TestWrite(t *testing.T) {
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
 						revsigs: revSig2,
-						p:       &DecryptedKeyData{vk: testPrivKey.PublicKey},
+						p:       &DecryptedKeyData{vk: &testPrivKey.PublicKey},
 						s:       PROTO_ZERO_SUITE,
 					},
 					readKey: testSymmKey,
 				},
 				priv: &DecryptedKeyData{
-					vk: testPrivKey.PublicKey,
+					vk: &testPrivKey.PublicKey,
 					wk: testPrivKey,
 				},
 			},
@@ -621,13 +673,13 @@ func TestUnmarshalWriteMarshal(t *testing.T) {
 			h: &History{
 				HistoryReadOnly: HistoryReadOnly{
 					HistoryVerifyOnly: HistoryVerifyOnly{
-						p: &DecryptedKeyData{vk: testPrivKey.PublicKey},
+						p: &DecryptedKeyData{vk: &testPrivKey.PublicKey},
 						s: PROTO_ZERO_SUITE,
 					},
 					readKey: testSymmKey,
 				},
 				priv: &DecryptedKeyData{
-					vk: testPrivKey.PublicKey,
+					vk: &testPrivKey.PublicKey,
 					wk: testPrivKey,
 				},
 			},
@@ -660,3 +712,80 @@ func TestUnmarshalWriteMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzHistoryUnmarshal(f *testing.F) {
+	f.Add(revSigBytes1)
+	f.Add(revSigBytes2)
+	f.Add(revSigBytesSalted)
+	f.Add([]byte("[7\"history]"))
+	f.Add([]byte("[7\"history[]]"))
+	f.Add([]byte("[7\"history[[7\"rev-sig[8\"revisioni-1e0:0:]0:]]]"))
+	h := &History{
+		HistoryReadOnly: HistoryReadOnly{
+			HistoryVerifyOnly: HistoryVerifyOnly{
+				p: DecryptedKeyData{vk: &testPrivKey.PublicKey, wk: testPrivKey},
+				s: PROTO_ZERO_SUITE,
+			},
+			readKey: testSymmKey,
+		},
+		priv: DecryptedKeyData{vk: &testPrivKey.PublicKey, wk: testPrivKey},
+	}
+	for _, p := range []PublicShard{
+		{Address: URN{dhash: SHA256D, hash: []byte("hash1")}},
+		{Address: URN{dhash: SHA256D, hash: []byte("hash2")}},
+	} {
+		if err := h.Write(p); err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+	}
+	b, err := h.Marshal()
+	if err != nil {
+		f.Fatalf("got error: %s", err)
+	}
+	f.Add(b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		got := &HistoryReadOnly{
+			HistoryVerifyOnly: HistoryVerifyOnly{
+				p: EncryptedKeyData{vk: &testPrivKey.PublicKey},
+				s: PROTO_ZERO_SUITE,
+			},
+			readKey: testSymmKey,
+		}
+		if err := got.Unmarshal(b); err != nil {
+			return
+		}
+		for i := -1; i <= got.Len(); i++ {
+			got.Verify(i)
+			got.ReadURN(i)
+		}
+		if _, err := got.Marshal(); err != nil {
+			t.Errorf("got marshal error: %s", err)
+		}
+	})
+}
+
+func TestVerifySalt(t *testing.T) {
+	h := &History{
+		HistoryReadOnly: HistoryReadOnly{
+			HistoryVerifyOnly: HistoryVerifyOnly{
+				p: &DecryptedKeyData{vk: &testPrivKey.PublicKey},
+				s: PROTO_ZERO_SUITE,
+			},
+			readKey: testSymmKey,
+		},
+		priv: &DecryptedKeyData{
+			vk: &testPrivKey.PublicKey,
+			wk: testPrivKey,
+		},
+	}
+	p := PublicShard{Address: URN{dhash: SHA256D, hash: []byte("hash1")}}
+	if err := h.write(p, []byte("salt")); err != nil {
+		t.Fatalf("got write error %s", err)
+	} else if err = h.Verify(0); err != nil {
+		t.Fatalf("got verification error %s", err)
+	}
+	h.revsigs[0].rev.salt = []byte("pepper")
+	if err := h.Verify(0); err == nil {
+		t.Errorf("got no error verifying a revision with a changed salt")
+	}
+}
@@ -68,6 +68,11 @@ func NewIDSC(s Suite, content, key SymmetricKey) (idsc IDSC, err error) {
 	return
 }
 
+// Suite returns the suite of encryption protocols of the datashard.
+func (i IDSC) Suite() Suite {
+	return i.s
+}
+
 // URN returns the datashard URN represented by this IDSC.
 func (i IDSC) URN() (s URN, err error) {
 	return newURNForSuite(i.s, i.hash)
@@ -120,3 +120,27 @@ func TestIDSCToURN(t *testing.T) {
 		})
 	}
 }
+
+func FuzzParseIDSC(f *testing.F) {
+	f.Add("idsc:0p.gl6qBg6i3dc5dz9cylxPcxIWn4SgLdTxWFzyqtwIljk.6B4Vy69Z6GnqF3VAk8eZkUBZbXgR5tWWoC1C_6Pbe7g")
+	f.Add("idsc:0pa..")
+	f.Add("idsc:nonexistent.AAAA.AAAA")
+	f.Add("idsc:0p.AAAA")
+	f.Add("idsc:0p.AAAA.AAAA:")
+	f.Fuzz(func(t *testing.T, s string) {
+		idsc, err := ParseIDSC(s)
+		if err != nil {
+			return
+		}
+		// The string form of a parsed IDSC must parse to itself.
+		idsc2, err := ParseIDSC(idsc.String())
+		if err != nil {
+			t.Fatalf("got error reparsing %q: %s", idsc, err)
+		} else if idsc2.String() != idsc.String() {
+			t.Errorf("got %q, want %q", idsc2, idsc)
+		}
+		if _, err = idsc.URN(); err != nil {
+			t.Errorf("got error: %s", err)
+		}
+	})
+}
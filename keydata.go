@@ -2,32 +2,40 @@ package dshards
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/cjslep/syrup"
 )
 
 const (
-	kKeyData = "keydata"
-	kKeyNote = "rsa-pcks1-sha256"
+	kKeyData        = "keydata"
+	kKeyNoteRSA     = "rsa-pcks1-sha256"
+	kKeyNoteEd25519 = "ed25519"
 )
 
+// PublicKeyer provides the key that verifies revisions of a mutable datashard:
+// either an *rsa.PublicKey or an ed25519.PublicKey, depending on the Suite.
 type PublicKeyer interface {
-	PublicKey() rsa.PublicKey
+	PublicKey() crypto.PublicKey
 }
 
+// PrivateKeyer provides the key that signs revisions of a mutable datashard:
+// either an *rsa.PrivateKey or an ed25519.PrivateKey, depending on the Suite.
 type PrivateKeyer interface {
 	PublicKeyer
-	PrivateKey() *rsa.PrivateKey
+	PrivateKey() crypto.Signer
 }
 
 var _ PublicKeyer = new(EncryptedKeyData)
 
 type EncryptedKeyData struct {
-	vk    rsa.PublicKey
+	vk    crypto.PublicKey
 	encwk []byte
 }
 
@@ -35,8 +43,8 @@ var _ PublicKeyer = new(DecryptedKeyData)
 var _ PrivateKeyer = new(DecryptedKeyData)
 
 type DecryptedKeyData struct {
-	vk rsa.PublicKey
-	wk *rsa.PrivateKey
+	vk crypto.PublicKey
+	wk crypto.Signer
 	// Used to encrypt the write-key (wk)
 	key SymmetricKey
 	s   Suite
@@ -46,15 +54,22 @@ func NewDecryptedKeyData(key SymmetricKey, s Suite) *DecryptedKeyData {
 	return &DecryptedKeyData{key: key, s: s}
 }
 
-func (e EncryptedKeyData) PublicKey() rsa.PublicKey {
+// NewHistory creates an empty History signed by this keydata's private key.
+// Its revisions are encrypted by the read key derived from the write key that
+// encrypts this keydata.
+func (d *DecryptedKeyData) NewHistory() *History {
+	return NewHistory(d.s, d, toReadKey(d.key))
+}
+
+func (e EncryptedKeyData) PublicKey() crypto.PublicKey {
 	return e.vk
 }
 
-func (d DecryptedKeyData) PublicKey() rsa.PublicKey {
+func (d DecryptedKeyData) PublicKey() crypto.PublicKey {
 	return d.vk
 }
 
-func (d DecryptedKeyData) PrivateKey() *rsa.PrivateKey {
+func (d DecryptedKeyData) PrivateKey() crypto.Signer {
 	return d.wk
 }
 
@@ -82,6 +97,7 @@ func (k *EncryptedKeyData) Unmarshal(b []byte) (err error) {
 	}
 
 	// Handle public key list
+	var note string
 	if vs1, ok := vs[1].([]interface{}); !ok {
 		err = fmt.Errorf("decoded keydata second item not list: %T", vs[1])
 		return
@@ -89,35 +105,20 @@ func (k *EncryptedKeyData) Unmarshal(b []byte) (err error) {
 		if len(vs1) != 2 {
 			err = fmt.Errorf("decoded keydata public key list not len() 2: %d", len(vs1))
 			return
-		} else if s, ok := vs1[0].(string); !ok || s != kKeyNote {
-			err = fmt.Errorf("decoded keydata public key unknown type: %s", vs1[0])
+		} else if note, ok = vs1[0].(string); !ok {
+			err = fmt.Errorf("decoded keydata public key type not string: %T", vs1[0])
 			return
 		}
-		if m, ok := vs1[1].(map[interface{}]interface{}); !ok {
-			err = fmt.Errorf("decoded keydata second item not dict: %T", vs1[1])
-			return
-		} else if n, ok := m[interface{}("n")]; !ok {
-			err = errors.New("decoded keydata second item has no n")
+		switch note {
+		case kKeyNoteRSA:
+			k.vk, err = unmarshalRSAPublicKey(vs1[1])
+		case kKeyNoteEd25519:
+			k.vk, err = unmarshalEd25519PublicKey(vs1[1])
+		default:
+			err = fmt.Errorf("decoded keydata public key unknown type: %s", note)
+		}
+		if err != nil {
 			return
-		} else if e, ok := m[interface{}("e")]; !ok {
-			err = errors.New("decoded keydata second item has no e")
-		} else {
-			switch nv := n.(type) {
-			case int64:
-				k.vk.N = big.NewInt(nv)
-			case *big.Int:
-				k.vk.N = nv
-			default:
-				err = fmt.Errorf("decoded keydata publickey n not int64 nor bigint: %T", n)
-				return
-			}
-			switch ev := e.(type) {
-			case int64:
-				k.vk.E = int(ev)
-			default:
-				err = fmt.Errorf("decoded keydata publickey e not int64: %T", n)
-				return
-			}
 		}
 	}
 
@@ -129,8 +130,8 @@ func (k *EncryptedKeyData) Unmarshal(b []byte) (err error) {
 		if len(vs2) != 2 {
 			err = fmt.Errorf("decoded keydata encrypted private key list not len() 2: %d", len(vs2))
 			return
-		} else if s, ok := vs2[0].(string); !ok || s != kKeyNote {
-			err = fmt.Errorf("decoded keydata encrypted private key unknown type: %s", vs2[0])
+		} else if s, ok := vs2[0].(string); !ok || s != note {
+			err = fmt.Errorf("decoded keydata encrypted private key type %s does not match public key type %s", vs2[0], note)
 			return
 		}
 		if eb, ok := vs2[1].([]byte); !ok {
@@ -143,12 +144,71 @@ func (k *EncryptedKeyData) Unmarshal(b []byte) (err error) {
 	return
 }
 
+func unmarshalRSAPublicKey(v interface{}) (vk *rsa.PublicKey, err error) {
+	vk = &rsa.PublicKey{}
+	if m, ok := v.(map[interface{}]interface{}); !ok {
+		err = fmt.Errorf("decoded keydata second item not dict: %T", v)
+		return
+	} else if n, ok := m[interface{}("n")]; !ok {
+		err = errors.New("decoded keydata second item has no n")
+		return
+	} else if e, ok := m[interface{}("e")]; !ok {
+		err = errors.New("decoded keydata second item has no e")
+		return
+	} else {
+		switch nv := n.(type) {
+		case int64:
+			vk.N = big.NewInt(nv)
+		case *big.Int:
+			vk.N = nv
+		default:
+			err = fmt.Errorf("decoded keydata publickey n not int64 nor bigint: %T", n)
+			return
+		}
+		switch ev := e.(type) {
+		case int64:
+			if ev < 2 || ev > math.MaxInt32 {
+				err = fmt.Errorf("decoded keydata publickey e out of range: %d", ev)
+				return
+			}
+			vk.E = int(ev)
+		default:
+			err = fmt.Errorf("decoded keydata publickey e not int64: %T", n)
+			return
+		}
+		if vk.N.Sign() <= 0 {
+			err = errors.New("decoded keydata publickey n not positive")
+			return
+		}
+	}
+	return
+}
+
+func unmarshalEd25519PublicKey(v interface{}) (vk ed25519.PublicKey, err error) {
+	if b, ok := v.([]byte); !ok {
+		err = fmt.Errorf("decoded keydata publickey not bytes: %T", v)
+	} else if len(b) != ed25519.PublicKeySize {
+		err = fmt.Errorf("decoded keydata publickey not len() %d: %d", ed25519.PublicKeySize, len(b))
+	} else {
+		vk = ed25519.PublicKey(b)
+	}
+	return
+}
+
 func (k *DecryptedKeyData) Unmarshal(b []byte) (err error) {
 	ek := &EncryptedKeyData{}
 	err = ek.Unmarshal(b)
 	if err != nil {
 		return
 	}
+	var impl SuiteImpl
+	impl, err = k.s.impl()
+	if err != nil {
+		return
+	} else if err = impl.CheckSigningKey(ek.vk); err != nil {
+		err = fmt.Errorf("dshards: suite %q cannot use the keydata: %w", k.s, err)
+		return
+	}
 	k.vk = ek.vk
 	var dec []byte
 	dec, err = decryptWriteKey(ek.encwk, k.key, k.s)
@@ -163,7 +223,31 @@ func (k *DecryptedKeyData) Unmarshal(b []byte) (err error) {
 	if err != nil {
 		return
 	}
-	k.wk = &rsa.PrivateKey{}
+	switch vk := k.vk.(type) {
+	case *rsa.PublicKey:
+		var wk *rsa.PrivateKey
+		if wk, err = unmarshalRSAPrivateKey(v); err != nil {
+			return
+		} else if wk.N.Cmp(vk.N) != 0 || wk.E != vk.E {
+			err = errors.New("decoded keydata private write key does not match public key")
+			return
+		}
+		k.wk = wk
+	case ed25519.PublicKey:
+		var wk ed25519.PrivateKey
+		if wk, err = unmarshalEd25519PrivateKey(v); err != nil {
+			return
+		} else if !bytes.Equal(wk.Public().(ed25519.PublicKey), vk) {
+			err = errors.New("decoded keydata private write key does not match public key")
+			return
+		}
+		k.wk = wk
+	}
+	return
+}
+
+func unmarshalRSAPrivateKey(v interface{}) (wk *rsa.PrivateKey, err error) {
+	wk = &rsa.PrivateKey{}
 	if m, ok := v.(map[interface{}]interface{}); !ok {
 		err = fmt.Errorf("decoded keydata decrypted private key unexpected type: %T", v)
 		return
@@ -216,30 +300,55 @@ func (k *DecryptedKeyData) Unmarshal(b []byte) (err error) {
 		err = fmt.Errorf("decoded keydata private write key qInv unexpected type: %T", qInvi)
 		return
 	} else {
-		k.wk.D = d
-		k.wk.Precomputed.Dp = dp
-		k.wk.Precomputed.Dq = dq
-		k.wk.PublicKey.E = int(e)
-		k.wk.PublicKey.N = n
-		k.wk.Primes = []*big.Int{p, q}
-		k.wk.Precomputed.Qinv = qInv
+		wk.D = d
+		wk.Precomputed.Dp = dp
+		wk.Precomputed.Dq = dq
+		wk.PublicKey.E = int(e)
+		wk.PublicKey.N = n
+		wk.Primes = []*big.Int{p, q}
+		wk.Precomputed.Qinv = qInv
+		if e < 2 || e > math.MaxInt32 {
+			err = fmt.Errorf("decoded keydata private write key e out of range: %d", e)
+			return
+		} else if err = wk.Validate(); err != nil {
+			err = fmt.Errorf("decoded keydata private write key invalid: %w", err)
+			return
+		}
+	}
+	return
+}
+
+func unmarshalEd25519PrivateKey(v interface{}) (wk ed25519.PrivateKey, err error) {
+	if m, ok := v.(map[interface{}]interface{}); !ok {
+		err = fmt.Errorf("decoded keydata decrypted private key unexpected type: %T", v)
+	} else if si, ok := m[interface{}("seed")]; !ok {
+		err = errors.New("decoded keydata private write key has no seed")
+	} else if seed, ok := si.([]byte); !ok {
+		err = fmt.Errorf("decoded keydata private write key seed unexpected type: %T", si)
+	} else if len(seed) != ed25519.SeedSize {
+		err = fmt.Errorf("decoded keydata private write key seed not len() %d: %d", ed25519.SeedSize, len(seed))
+	} else {
+		wk = ed25519.NewKeyFromSeed(seed)
 	}
 	return
 }
 
 func (k EncryptedKeyData) Marshal() (b []byte, err error) {
 	var buf bytes.Buffer
+	var note string
+	var pk interface{}
+	note, pk, err = marshalPublicKey(k.vk)
+	if err != nil {
+		return
+	}
 	v := []interface{}{
 		kKeyData,
 		[]interface{}{
-			kKeyNote,
-			pubKey{
-				N: k.vk.N,
-				E: k.vk.E,
-			},
+			note,
+			pk,
 		},
 		[]interface{}{
-			kKeyNote,
+			note,
 			k.encwk,
 		},
 	}
@@ -250,34 +359,50 @@ func (k EncryptedKeyData) Marshal() (b []byte, err error) {
 
 func (k DecryptedKeyData) Marshal() (b []byte, err error) {
 	var buf bytes.Buffer
+	var note string
+	var pk interface{}
+	note, pk, err = marshalPublicKey(k.vk)
+	if err != nil {
+		return
+	}
 	v := []interface{}{
 		kKeyData,
 		[]interface{}{
-			kKeyNote,
-			pubKey{
-				N: k.vk.N,
-				E: k.vk.E,
-			},
+			note,
+			pk,
 		},
 	}
 	// Append entire []interface{} as the third item.
-	if len(k.wk.Primes) != 2 {
-		err = fmt.Errorf("dshards: keydata cannot serialize %d primes", len(k.wk.Primes))
+	var encV interface{}
+	switch wk := k.wk.(type) {
+	case *rsa.PrivateKey:
+		if len(wk.Primes) != 2 {
+			err = fmt.Errorf("dshards: keydata cannot serialize %d primes", len(wk.Primes))
+			return
+		}
+		wk.Precompute()
+		encV = privKey{
+			D:    wk.D,
+			Dp:   wk.Precomputed.Dp,
+			Dq:   wk.Precomputed.Dq,
+			E:    wk.PublicKey.E,
+			N:    wk.PublicKey.N,
+			P:    wk.Primes[0],
+			Q:    wk.Primes[1],
+			QInv: wk.Precomputed.Qinv,
+		}
+	case ed25519.PrivateKey:
+		encV = ed25519PrivKey{Seed: wk.Seed()}
+	default:
+		err = fmt.Errorf("dshards: keydata cannot serialize private key %T", k.wk)
+		return
+	}
+	if wkNote, errN := keyNoteOf(k.wk.Public()); errN != nil || wkNote != note {
+		err = fmt.Errorf("dshards: keydata private key %T does not match public key %T", k.wk, k.vk)
 		return
 	}
-	k.wk.Precompute()
 	var toEncBuf bytes.Buffer
 	defer toEncBuf.Reset()
-	encV := privKey{
-		D:    k.wk.D,
-		Dp:   k.wk.Precomputed.Dp,
-		Dq:   k.wk.Precomputed.Dq,
-		E:    k.wk.PublicKey.E,
-		N:    k.wk.PublicKey.N,
-		P:    k.wk.Primes[0],
-		Q:    k.wk.Primes[1],
-		QInv: k.wk.Precomputed.Qinv,
-	}
 	err = syrup.NewEncoder(syrup.NewPrototypeEncoding(), &toEncBuf).Encode(encV)
 	if err != nil {
 		return
@@ -288,10 +413,35 @@ func (k DecryptedKeyData) Marshal() (b []byte, err error) {
 		return
 	}
 	v = append(v, []interface{}{
-		kKeyNote,
+		note,
 		enc,
 	})
 	err = syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(v)
 	b = buf.Bytes()
 	return
 }
+
+// marshalPublicKey determines the key note and serializable form of a public
+// key.
+func marshalPublicKey(vk crypto.PublicKey) (note string, v interface{}, err error) {
+	switch pk := vk.(type) {
+	case *rsa.PublicKey:
+		note = kKeyNoteRSA
+		v = pubKey{
+			N: pk.N,
+			E: pk.E,
+		}
+	case ed25519.PublicKey:
+		note = kKeyNoteEd25519
+		v = []byte(pk)
+	default:
+		err = fmt.Errorf("dshards: keydata cannot serialize public key %T", vk)
+	}
+	return
+}
+
+// keyNoteOf determines the key note of a public key.
+func keyNoteOf(vk crypto.PublicKey) (note string, err error) {
+	note, _, err = marshalPublicKey(vk)
+	return
+}
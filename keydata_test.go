@@ -2,9 +2,12 @@ package dshards
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
+	"math/big"
 	"strconv"
 	"testing"
 
@@ -71,7 +74,7 @@ func init() {
 
 func TestMarshalDecryptedKeyData(t *testing.T) {
 	dk := &DecryptedKeyData{
-		vk:  testPrivKey.PublicKey,
+		vk:  &testPrivKey.PublicKey,
 		wk:  testPrivKey,
 		key: testSymmKey,
 		s:   PROTO_ZERO_SUITE,
@@ -82,9 +85,9 @@ func TestMarshalDecryptedKeyData(t *testing.T) {
 	}
 	expected := append(
 		append([]byte(`[7"keydata[16"rsa-pcks1-sha256{1"ni`+
-			dk.vk.N.Text(10)+
+			dk.vk.(*rsa.PublicKey).N.Text(10)+
 			`e1"ei`+
-			strconv.FormatInt(int64(dk.vk.E), 10)+
+			strconv.FormatInt(int64(dk.vk.(*rsa.PublicKey).E), 10)+
 			`e}][16"rsa-pcks1-sha256`+
 			strconv.FormatInt(int64(len(testEncKey)), 10)+
 			":"),
@@ -99,7 +102,7 @@ func TestMarshalDecryptedKeyData(t *testing.T) {
 func TestMarshalEncryptedKeyData(t *testing.T) {
 	str := "arbitrary binary bytes"
 	ek := &EncryptedKeyData{
-		vk:    testPrivKey.PublicKey,
+		vk:    &testPrivKey.PublicKey,
 		encwk: []byte(str),
 	}
 	b, err := ek.Marshal()
@@ -108,9 +111,9 @@ func TestMarshalEncryptedKeyData(t *testing.T) {
 	}
 	expected := append(
 		append([]byte(`[7"keydata[16"rsa-pcks1-sha256{1"ni`+
-			ek.vk.N.Text(10)+
+			ek.vk.(*rsa.PublicKey).N.Text(10)+
 			`e1"ei`+
-			strconv.FormatInt(int64(ek.vk.E), 10)+
+			strconv.FormatInt(int64(ek.vk.(*rsa.PublicKey).E), 10)+
 			`e}][16"rsa-pcks1-sha256`+
 			strconv.FormatInt(int64(len(str)), 10)+
 			":"),
@@ -137,22 +140,22 @@ func TestUnmarshalDecryptedKeyData(t *testing.T) {
 	err := dk.Unmarshal(in)
 	if err != nil {
 		t.Errorf("got error: %s", err)
-	} else if dk.vk.N.Cmp(testPrivKey.PublicKey.N) != 0 {
-		t.Errorf("got %v, want %v", dk.vk.N.Text(10), testPrivKey.PublicKey.N.Text(10))
-	} else if dk.vk.E != testPrivKey.PublicKey.E {
-		t.Errorf("got %d, want %d", dk.vk.E, testPrivKey.PublicKey.E)
-	} else if dk.wk.PublicKey.N.Cmp(testPrivKey.PublicKey.N) != 0 {
-		t.Errorf("got %v, want %v", dk.wk.PublicKey.N.Text(10), testPrivKey.PublicKey.N.Text(10))
-	} else if dk.wk.PublicKey.E != testPrivKey.PublicKey.E {
-		t.Errorf("got %d, want %d", dk.wk.PublicKey.E, testPrivKey.PublicKey.E)
-	} else if dk.wk.D.Cmp(testPrivKey.D) != 0 {
-		t.Errorf("got %v, want %v", dk.wk.D.Text(10), testPrivKey.D.Text(10))
-	} else if len(dk.wk.Primes) != len(testPrivKey.Primes) || len(dk.wk.Primes) != 2 {
-		t.Errorf("got %d, want %d && want 2", len(dk.wk.Primes), len(testPrivKey.Primes))
-	} else if dk.wk.Primes[0].Cmp(testPrivKey.Primes[0]) != 0 {
-		t.Errorf("got %v, want %v", dk.wk.Primes[0].Text(10), testPrivKey.Primes[0].Text(10))
-	} else if dk.wk.Primes[1].Cmp(testPrivKey.Primes[1]) != 0 {
-		t.Errorf("got %v, want %v", dk.wk.Primes[1].Text(10), testPrivKey.Primes[1].Text(10))
+	} else if dk.vk.(*rsa.PublicKey).N.Cmp(testPrivKey.PublicKey.N) != 0 {
+		t.Errorf("got %v, want %v", dk.vk.(*rsa.PublicKey).N.Text(10), testPrivKey.PublicKey.N.Text(10))
+	} else if dk.vk.(*rsa.PublicKey).E != testPrivKey.PublicKey.E {
+		t.Errorf("got %d, want %d", dk.vk.(*rsa.PublicKey).E, testPrivKey.PublicKey.E)
+	} else if dk.wk.(*rsa.PrivateKey).PublicKey.N.Cmp(testPrivKey.PublicKey.N) != 0 {
+		t.Errorf("got %v, want %v", dk.wk.(*rsa.PrivateKey).PublicKey.N.Text(10), testPrivKey.PublicKey.N.Text(10))
+	} else if dk.wk.(*rsa.PrivateKey).PublicKey.E != testPrivKey.PublicKey.E {
+		t.Errorf("got %d, want %d", dk.wk.(*rsa.PrivateKey).PublicKey.E, testPrivKey.PublicKey.E)
+	} else if dk.wk.(*rsa.PrivateKey).D.Cmp(testPrivKey.D) != 0 {
+		t.Errorf("got %v, want %v", dk.wk.(*rsa.PrivateKey).D.Text(10), testPrivKey.D.Text(10))
+	} else if len(dk.wk.(*rsa.PrivateKey).Primes) != len(testPrivKey.Primes) || len(dk.wk.(*rsa.PrivateKey).Primes) != 2 {
+		t.Errorf("got %d, want %d && want 2", len(dk.wk.(*rsa.PrivateKey).Primes), len(testPrivKey.Primes))
+	} else if dk.wk.(*rsa.PrivateKey).Primes[0].Cmp(testPrivKey.Primes[0]) != 0 {
+		t.Errorf("got %v, want %v", dk.wk.(*rsa.PrivateKey).Primes[0].Text(10), testPrivKey.Primes[0].Text(10))
+	} else if dk.wk.(*rsa.PrivateKey).Primes[1].Cmp(testPrivKey.Primes[1]) != 0 {
+		t.Errorf("got %v, want %v", dk.wk.(*rsa.PrivateKey).Primes[1].Text(10), testPrivKey.Primes[1].Text(10))
 	}
 }
 
@@ -172,12 +175,238 @@ func TestUnmarshalEncryptedKeyData(t *testing.T) {
 	err := ek.Unmarshal(in)
 	if err != nil {
 		t.Errorf("got error: %s", err)
-	} else if ek.vk.N.Cmp(testPrivKey.PublicKey.N) != 0 {
-		t.Errorf("got %v, want %v", ek.vk.N.Text(10), testPrivKey.PublicKey.N.Text(10))
-	} else if ek.vk.E != testPrivKey.PublicKey.E {
-		t.Errorf("got %d, want %d", ek.vk.E, testPrivKey.PublicKey.E)
+	} else if ek.vk.(*rsa.PublicKey).N.Cmp(testPrivKey.PublicKey.N) != 0 {
+		t.Errorf("got %v, want %v", ek.vk.(*rsa.PublicKey).N.Text(10), testPrivKey.PublicKey.N.Text(10))
+	} else if ek.vk.(*rsa.PublicKey).E != testPrivKey.PublicKey.E {
+		t.Errorf("got %d, want %d", ek.vk.(*rsa.PublicKey).E, testPrivKey.PublicKey.E)
 	} else if !bytes.Equal(ek.encwk, []byte(str)) {
 		t.Errorf("got %v, want %v", ek.encwk, str)
 		t.Errorf("got len %d, want len %d", len(ek.encwk), len(str))
 	}
 }
+
+func TestUnmarshalInvalidKeyData(t *testing.T) {
+	keyData := func(n, e string) []byte {
+		return append(
+			append([]byte(`[7"keydata[16"rsa-pcks1-sha256{1"ni`+n+`e1"ei`+e+
+				`e}][16"rsa-pcks1-sha256`+
+				strconv.FormatInt(int64(len(testEncKey)), 10)+
+				":"),
+				testEncKey...),
+			[]byte("]]")...)
+	}
+	otherN := new(big.Int).Add(testPrivKey.PublicKey.N, big.NewInt(2))
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{
+			name: "Zero Modulus",
+			in:   keyData("0", "65537"),
+		},
+		{
+			name: "Negative Modulus",
+			in:   keyData("-"+testPrivKey.PublicKey.N.Text(10), "65537"),
+		},
+		{
+			name: "Exponent One",
+			in:   keyData(testPrivKey.PublicKey.N.Text(10), "1"),
+		},
+		{
+			name: "Exponent Too Large",
+			in:   keyData(testPrivKey.PublicKey.N.Text(10), "4294967297"),
+		},
+		{
+			name: "Mismatched Public Key",
+			in:   keyData(otherN.Text(10), strconv.Itoa(testPrivKey.PublicKey.E)),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dk := NewDecryptedKeyData(testSymmKey, PROTO_ZERO_SUITE)
+			if err := dk.Unmarshal(test.in); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestEd25519KeyData(t *testing.T) {
+	vk, wk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	dk := &DecryptedKeyData{
+		vk:  vk,
+		wk:  wk,
+		key: testSymmKey,
+		s:   PROTO_ZERO_ED25519_SUITE,
+	}
+	b, err := dk.Marshal()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	}
+
+	ek := &EncryptedKeyData{}
+	if err = ek.Unmarshal(b); err != nil {
+		t.Fatalf("got unmarshal error: %s", err)
+	} else if !bytes.Equal(ek.vk.(ed25519.PublicKey), vk) {
+		t.Errorf("got %v, want %v", ek.vk, vk)
+	}
+	eb, err := ek.Marshal()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	} else if !bytes.Equal(eb, b) {
+		t.Errorf("got %s, want %s", eb, b)
+	}
+
+	got := NewDecryptedKeyData(testSymmKey, PROTO_ZERO_ED25519_SUITE)
+	if err = got.Unmarshal(b); err != nil {
+		t.Fatalf("got unmarshal error: %s", err)
+	} else if !bytes.Equal(got.wk.(ed25519.PrivateKey), wk) {
+		t.Errorf("got different private key")
+	}
+
+	wrongSuite := NewDecryptedKeyData(testSymmKey, PROTO_ZERO_SUITE)
+	if err = wrongSuite.Unmarshal(b); err == nil {
+		t.Errorf("got no error unmarshalling ed25519 keydata for suite %q", PROTO_ZERO_SUITE)
+	}
+}
+
+func TestSignRevision(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name      string
+		s         Suite
+		priv      crypto.Signer
+		pub       crypto.PublicKey
+		expectErr bool
+	}{
+		{
+			name: "RSA",
+			s:    PROTO_ZERO_SUITE,
+			priv: testPrivKey,
+			pub:  &testPrivKey.PublicKey,
+		},
+		{
+			name: "Ed25519",
+			s:    PROTO_ZERO_ED25519_SUITE,
+			priv: edPriv,
+			pub:  edPub,
+		},
+		{
+			name:      "RSA Key For Ed25519 Suite",
+			s:         PROTO_ZERO_ED25519_SUITE,
+			priv:      testPrivKey,
+			pub:       &testPrivKey.PublicKey,
+			expectErr: true,
+		},
+		{
+			name:      "Ed25519 Key For RSA Suite",
+			s:         PROTO_ZERO_SUITE,
+			priv:      edPriv,
+			pub:       edPub,
+			expectErr: true,
+		},
+	}
+	msg := []byte("revision signing bytes")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sig, err := signRevision(test.priv, msg, test.s)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("got no error, want one")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("got sign error: %s", err)
+			}
+			if err = verifyRevision(test.pub, msg, sig, test.s); err != nil {
+				t.Errorf("got verify error: %s", err)
+			}
+			if err = verifyRevision(test.pub, []byte("tampered"), sig, test.s); err == nil {
+				t.Errorf("got no verify error for tampered revision")
+			}
+		})
+	}
+}
+
+// addKeyDataSeeds adds keydata to the seed corpus whose private keys are not
+// encrypted, as FuzzDecryptedKeyDataUnmarshal encrypts them.
+func addKeyDataSeeds(f *testing.F) {
+	wk := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	for _, dk := range []*DecryptedKeyData{
+		{vk: &testPrivKey.PublicKey, wk: testPrivKey, key: testSymmKey, s: PROTO_ZERO_SUITE},
+		{vk: wk.Public(), wk: wk, key: testSymmKey, s: PROTO_ZERO_SUITE},
+	} {
+		b, err := dk.Marshal()
+		if err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+		ek := &EncryptedKeyData{}
+		if err = ek.Unmarshal(b); err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+		ek.encwk, err = decryptWriteKey(ek.encwk, testSymmKey, PROTO_ZERO_SUITE)
+		if err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+		b, err = ek.Marshal()
+		if err != nil {
+			f.Fatalf("got error: %s", err)
+		}
+		f.Add(b)
+		f.Add(b[:len(b)/2])
+	}
+}
+
+func FuzzEncryptedKeyDataUnmarshal(f *testing.F) {
+	addKeyDataSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ek := &EncryptedKeyData{}
+		if err := ek.Unmarshal(b); err != nil {
+			return
+		}
+		// Unmarshalled keydata must marshal back.
+		b2, err := ek.Marshal()
+		if err != nil {
+			t.Fatalf("got marshal error: %s", err)
+		}
+		ek2 := &EncryptedKeyData{}
+		if err = ek2.Unmarshal(b2); err != nil {
+			t.Fatalf("got error unmarshalling %q: %s", b2, err)
+		}
+	})
+}
+
+func FuzzDecryptedKeyDataUnmarshal(f *testing.F) {
+	addKeyDataSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// Encrypt the private key, so that the fuzzer can explore
+		// unmarshalling it.
+		ek := &EncryptedKeyData{}
+		if err := ek.Unmarshal(b); err == nil {
+			ek.encwk, err = encryptWriteKey(ek.encwk, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if b, err = ek.Marshal(); err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+		}
+		dk := NewDecryptedKeyData(testSymmKey, PROTO_ZERO_SUITE)
+		if err := dk.Unmarshal(b); err != nil {
+			return
+		}
+		// Unmarshalled keydata must be able to sign revisions.
+		sig, err := signRevision(dk.PrivateKey(), []byte("revision"), PROTO_ZERO_SUITE)
+		if err != nil {
+			return
+		} else if err = verifyRevision(dk.PublicKey(), []byte("revision"), sig, PROTO_ZERO_SUITE); err != nil {
+			t.Errorf("got verify error: %s", err)
+		}
+	})
+}
@@ -13,6 +13,17 @@ import (
 type Cap interface {
 	String() string
 	KeyDataURN() (URN, error)
+	// Suite returns the suite of encryption protocols of the mutable
+	// datashard.
+	Suite() Suite
+	// Version returns the revision this capability is pinned to, and the
+	// hash of that revision's URN if also pinned. Not ok if the capability
+	// is not pinned to a revision.
+	Version() (n int, hash []byte, ok bool)
+	// AtVersion returns a capability with the same access level, pinned to
+	// the revision and, if not empty, the hash of that revision's URN. A
+	// negative revision removes any pin.
+	AtVersion(n int, hash []byte) Cap
 }
 
 // VerifyCap is the basic verifiable capability of a mutable datashard.
@@ -234,6 +245,67 @@ func (m verifyMDSC) versionSuffixString() string {
 	return buf.String()
 }
 
+// pinned copies this capability, pinned at the version.
+func (m verifyMDSC) pinned(n int, hash []byte) verifyMDSC {
+	v := verifyMDSC{
+		a:              m.a,
+		s:              m.s,
+		keyDataHash:    make([]byte, len(m.keyDataHash)),
+		keyDataSymmKey: make([]byte, len(m.keyDataSymmKey)),
+		nVersion:       noVersionProvided,
+	}
+	copy(v.keyDataHash, m.keyDataHash)
+	copy(v.keyDataSymmKey, m.keyDataSymmKey)
+	if n >= 0 {
+		v.nVersion = n
+		if len(hash) > 0 {
+			v.hashVersion = make([]byte, len(hash))
+			copy(v.hashVersion, hash)
+		}
+	}
+	return v
+}
+
+func (m verifyMDSC) Version() (n int, hash []byte, ok bool) {
+	if m.nVersion == noVersionProvided {
+		return
+	}
+	n = m.nVersion
+	ok = true
+	if len(m.hashVersion) > 0 {
+		hash = make([]byte, len(m.hashVersion))
+		copy(hash, m.hashVersion)
+	}
+	return
+}
+
+func (m verifyMDSC) AtVersion(n int, hash []byte) Cap {
+	v := m.pinned(n, hash)
+	return &v
+}
+
+func (r readMDSC) AtVersion(n int, hash []byte) Cap {
+	v := &readMDSC{
+		verifyMDSC: r.verifyMDSC.pinned(n, hash),
+		readKey:    make([]byte, len(r.readKey)),
+	}
+	copy(v.readKey, r.readKey)
+	return v
+}
+
+func (m mdsc) AtVersion(n int, hash []byte) Cap {
+	v := &mdsc{
+		verifyMDSC: m.verifyMDSC.pinned(n, hash),
+		writeKey:   make([]byte, len(m.writeKey)),
+	}
+	copy(v.writeKey, m.writeKey)
+	return v
+}
+
+func (m verifyMDSC) Suite() Suite {
+	return m.s
+}
+
 func (m verifyMDSC) KeyDataURN() (URN, error) {
 	return newURNForSuite(m.s, m.keyDataHash)
 }
@@ -319,3 +391,57 @@ func (r readMDSC) VerifyCap() VerifyCap {
 	copy(v.hashVersion, r.hashVersion)
 	return v
 }
+
+// verifyCapParts obtains what is needed to verify the mutable datashard of a
+// VerifyCap.
+func verifyCapParts(c VerifyCap) (v verifyMDSC, err error) {
+	switch m := c.(type) {
+	case *verifyMDSC:
+		v = *m
+	case verifyMDSC:
+		v = m
+	case *readMDSC:
+		v = m.verifyMDSC
+	case readMDSC:
+		v = m.verifyMDSC
+	case *mdsc:
+		v = m.verifyMDSC
+	case mdsc:
+		v = m.verifyMDSC
+	default:
+		err = fmt.Errorf("dshards: unsupported verify capability %T", c)
+	}
+	return
+}
+
+// readCapParts obtains what is needed to read the mutable datashard of a
+// ReadCap.
+func readCapParts(c ReadCap) (v verifyMDSC, readKey SymmetricKey, err error) {
+	switch m := c.(type) {
+	case *readMDSC:
+		v, readKey = m.verifyMDSC, m.readKey
+	case readMDSC:
+		v, readKey = m.verifyMDSC, m.readKey
+	case *mdsc:
+		v, readKey = m.verifyMDSC, toReadKey(m.writeKey)
+	case mdsc:
+		v, readKey = m.verifyMDSC, toReadKey(m.writeKey)
+	default:
+		err = fmt.Errorf("dshards: unsupported read capability %T", c)
+	}
+	return
+}
+
+// writeCapParts obtains what is needed to write the mutable datashard of a
+// ReadWriteCap.
+func writeCapParts(c ReadWriteCap) (w mdsc, err error) {
+	switch m := c.(type) {
+	case *mdsc:
+		w = *m
+	case mdsc:
+		w = m
+	default:
+		err = fmt.Errorf("dshards: unsupported read-write capability %T", c)
+	}
+	return
+}
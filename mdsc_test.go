@@ -161,3 +161,99 @@ func TestParseMDSCReString(t *testing.T) {
 	}
 
 }
+
+func TestVersion(t *testing.T) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := ParseMDSC(test.mdsc)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			n, hash, ok := c.Version()
+			if ok != (test.nVersion != noVersionProvided) {
+				t.Errorf("got ok %v, want %v", ok, !ok)
+			} else if ok && n != test.nVersion {
+				t.Errorf("got %d, want %d", n, test.nVersion)
+			} else if !bytes.Equal(hash, test.hashVersion) {
+				t.Errorf("got %v, want %v", hash, test.hashVersion)
+			}
+		})
+	}
+}
+
+func TestAtVersion(t *testing.T) {
+	hash := []byte{108, 210, 24, 90, 93, 213, 180, 126, 94, 222, 109, 25, 158, 159, 52, 125, 78, 106, 180, 126, 136, 190, 170, 70, 151, 113, 165, 201, 121, 141, 160, 61}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := ParseMDSC(test.mdsc)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			pinned := c.AtVersion(3, hash)
+			if n, h, ok := pinned.Version(); !ok || n != 3 || !bytes.Equal(h, hash) {
+				t.Errorf("got %d %v %v, want %d %v %v", n, h, ok, 3, hash, true)
+			}
+			reparsed, err := ParseMDSC(pinned.String())
+			if err != nil {
+				t.Fatalf("got reparse error: %s", err)
+			} else if reparsed.String() != pinned.String() {
+				t.Errorf("got %q, want %q", reparsed.String(), pinned.String())
+			}
+			switch test.accessLevel {
+			case verifyAL:
+				if _, ok := pinned.(*verifyMDSC); !ok {
+					t.Errorf("got unexpected type: %T", pinned)
+				}
+			case readAL:
+				if _, ok := pinned.(ReadCap); !ok {
+					t.Errorf("got unexpected type: %T", pinned)
+				}
+			case writeAL:
+				if _, ok := pinned.(ReadWriteCap); !ok {
+					t.Errorf("got unexpected type: %T", pinned)
+				}
+			}
+			unpinned := pinned.AtVersion(-1, nil)
+			if _, _, ok := unpinned.Version(); ok {
+				t.Errorf("got pinned, want unpinned")
+			}
+			if test.nVersion == noVersionProvided && unpinned.String() != test.mdsc {
+				t.Errorf("got %q, want %q", unpinned.String(), test.mdsc)
+			}
+		})
+	}
+}
+
+func FuzzParseMDSC(f *testing.F) {
+	for _, test := range tests {
+		f.Add(test.mdsc)
+	}
+	f.Add("mdsc:w.0pa.AAAA.AAAA.AAAA/3/AAAA")
+	f.Add("mdsc:r.0p.AAAA.AAAA.AAAA/-1")
+	f.Add("mdsc:v.0p.AAAA.AAAA/1/AAAA/AAAA")
+	f.Add("mdsc:v.0p.AAAA.AAAA.AAAA")
+	f.Add("mdsc:x.0p.AAAA.AAAA")
+	f.Fuzz(func(t *testing.T, s string) {
+		c, err := ParseMDSC(s)
+		if err != nil {
+			return
+		}
+		// The string form of a parsed capability must parse to itself.
+		c2, err := ParseMDSC(c.String())
+		if err != nil {
+			t.Fatalf("got error reparsing %q: %s", c, err)
+		} else if c2.String() != c.String() {
+			t.Errorf("got %q, want %q", c2, c)
+		}
+		if _, err = c.KeyDataURN(); err != nil {
+			t.Errorf("got error: %s", err)
+		}
+		c.Version()
+		switch cc := c.(type) {
+		case ReadWriteCap:
+			cc.ReadCap().VerifyCap()
+		case ReadCap:
+			cc.VerifyCap()
+		}
+	})
+}
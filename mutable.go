@@ -0,0 +1,250 @@
+package dshards
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	mdscSymmKeyLen     = 32
+	mdscSigningKeyBits = 2048
+)
+
+// NewMDSC creates a brand-new mutable datashard, generating its write key and
+// the private key that signs its revisions.
+//
+// The returned shards hold the encrypted keydata, and must be stored where the
+// capability's KeyDataURN can be fetched. The returned DecryptedKeyData
+// creates the empty History of the mutable datashard.
+func NewMDSC(s Suite, rand io.Reader) (c ReadWriteCap, dk *DecryptedKeyData, priv []PrivateShard, err error) {
+	writeKey := make(SymmetricKey, mdscSymmKeyLen)
+	if _, err = io.ReadFull(rand, writeKey); err != nil {
+		return
+	}
+	keyDataKey := make(SymmetricKey, mdscSymmKeyLen)
+	if _, err = io.ReadFull(rand, keyDataKey); err != nil {
+		return
+	}
+	dk = NewDecryptedKeyData(writeKey, s)
+	dk.wk, err = generateSigningKey(s, rand)
+	if err != nil {
+		return
+	}
+	dk.vk = dk.wk.Public()
+
+	var b []byte
+	b, err = dk.Marshal()
+	if err != nil {
+		return
+	}
+	var rootIdx int
+	rootIdx, priv, err = Encrypt(b, keyDataKey, s)
+	if err != nil {
+		return
+	}
+	c = &mdsc{
+		verifyMDSC: verifyMDSC{
+			a:              writeAL,
+			s:              s,
+			keyDataHash:    priv[rootIdx].AddressAndKey.hash,
+			keyDataSymmKey: keyDataKey,
+			nVersion:       noVersionProvided,
+		},
+		writeKey: writeKey,
+	}
+	return
+}
+
+// ResolveLatest fetches, verifies, and decrypts the latest revision of a
+// mutable datashard. If the capability is pinned to a version, that revision
+// is decrypted instead. If the pin includes a hash, the URN of the pinned
+// revision must have that hash.
+//
+// Every revision in the History must have a valid signature, even when an
+// earlier revision is pinned.
+func ResolveLatest(ctx context.Context, c ReadCap, f HistoryFetcher) (rev int, content []byte, err error) {
+	var v verifyMDSC
+	var readKey SymmetricKey
+	v, readKey, err = readCapParts(c)
+	if err != nil {
+		return
+	}
+	var h *HistoryReadOnly
+	h, err = fetchVerifiedHistory(ctx, v, readKey, f)
+	if err != nil {
+		return
+	} else if h.Len() == 0 {
+		err = errors.New("dshards: mutable datashard has no revisions")
+		return
+	}
+	rev = h.Len() - 1
+	if v.nVersion != noVersionProvided {
+		if v.nVersion >= h.Len() {
+			err = fmt.Errorf("dshards: pinned revision %d not in history of %d revisions", v.nVersion, h.Len())
+			return
+		}
+		rev = v.nVersion
+	}
+	var ic IDSC
+	ic, err = h.ReadIDSC(rev)
+	if err != nil {
+		return
+	} else if len(v.hashVersion) > 0 && subtle.ConstantTimeCompare(ic.hash, v.hashVersion) != 1 {
+		err = fmt.Errorf("dshards: revision %d does not match the pinned hash", rev)
+		return
+	}
+	content, err = DecryptAll(ctx, ic, f)
+	return
+}
+
+// FetchHistory fetches the keydata and History of a mutable datashard, without
+// verifying any of its revisions. Use Verify on each revision to check its
+// signature.
+func FetchHistory(ctx context.Context, c VerifyCap, f HistoryFetcher) (h *HistoryVerifyOnly, err error) {
+	var v verifyMDSC
+	v, err = verifyCapParts(c)
+	if err != nil {
+		return
+	}
+	var r *HistoryReadOnly
+	r, err = fetchHistory(ctx, v, nil, f)
+	if err != nil {
+		return
+	}
+	h = &r.HistoryVerifyOnly
+	return
+}
+
+// FetchReadableHistory is like FetchHistory, but the History can also read
+// the URN of each revision and the IDSC that decrypts its content.
+func FetchReadableHistory(ctx context.Context, c ReadCap, f HistoryFetcher) (h *HistoryReadOnly, err error) {
+	var v verifyMDSC
+	var readKey SymmetricKey
+	v, readKey, err = readCapParts(c)
+	if err != nil {
+		return
+	}
+	h, err = fetchHistory(ctx, v, readKey, f)
+	return
+}
+
+// fetchVerifiedHistory fetches the keydata and History of a mutable
+// datashard, verifying the signature of every revision.
+func fetchVerifiedHistory(ctx context.Context, v verifyMDSC, readKey SymmetricKey, f HistoryFetcher) (h *HistoryReadOnly, err error) {
+	h, err = fetchHistory(ctx, v, readKey, f)
+	if err != nil {
+		return
+	}
+	err = verifyHistory(&h.HistoryVerifyOnly)
+	return
+}
+
+// fetchHistory fetches the keydata and History of a mutable datashard. A
+// missing History is treated as empty, as no revision has been published yet.
+func fetchHistory(ctx context.Context, v verifyMDSC, readKey SymmetricKey, f HistoryFetcher) (h *HistoryReadOnly, err error) {
+	var kd URN
+	kd, err = v.KeyDataURN()
+	if err != nil {
+		return
+	}
+	var b []byte
+	b, err = DecryptAll(ctx, IDSC{s: v.s, hash: v.keyDataHash, symmKey: v.keyDataSymmKey}, f)
+	if err != nil {
+		return
+	}
+	ek := &EncryptedKeyData{}
+	if err = ek.Unmarshal(b); err != nil {
+		return
+	}
+	h = NewHistoryReadOnly(v.s, ek, readKey)
+	b, err = f.FetchHistory(ctx, kd)
+	if err == ErrNotFound {
+		err = nil
+	} else if err == nil {
+		err = h.Unmarshal(b)
+	}
+	return
+}
+
+// verifyHistory ensures every revision is in order and correctly signed.
+func verifyHistory(h *HistoryVerifyOnly) (err error) {
+	for i := 0; i < h.Len(); i++ {
+		if h.revsigs[i].rev.n != int64(i) {
+			err = fmt.Errorf("dshards: history has revision %d at position %d", h.revsigs[i].rev.n, i)
+			return
+		} else if err = h.Verify(i); err != nil {
+			err = fmt.Errorf("dshards: revision %d failed verification: %w", i, err)
+			return
+		}
+	}
+	return
+}
+
+// Publish encrypts the content read from r as a new revision of a mutable
+// datashard. The shards of the content and the History, with the new signed
+// revision appended, are put into the store. The new revision is returned.
+//
+// A missing History is treated as empty. Publishing is not atomic, so
+// concurrent publishers to the same mutable datashard may overwrite each
+// other's revisions. Each revision's content key is salted at random, so even
+// then no two publishes share a key.
+func Publish(ctx context.Context, c ReadWriteCap, r io.Reader, st HistoryStore) (rev int, err error) {
+	var w mdsc
+	w, err = writeCapParts(c)
+	if err != nil {
+		return
+	}
+	var kd URN
+	kd, err = w.KeyDataURN()
+	if err != nil {
+		return
+	}
+	var b []byte
+	b, err = DecryptAll(ctx, IDSC{s: w.s, hash: w.keyDataHash, symmKey: w.keyDataSymmKey}, st)
+	if err != nil {
+		return
+	}
+	dk := NewDecryptedKeyData(w.writeKey, w.s)
+	if err = dk.Unmarshal(b); err != nil {
+		return
+	}
+	h := dk.NewHistory()
+	b, err = st.FetchHistory(ctx, kd)
+	if err == ErrNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	} else if err = h.Unmarshal(b); err != nil {
+		return
+	} else if err = verifyHistory(&h.HistoryVerifyOnly); err != nil {
+		return
+	}
+
+	var salt []byte
+	if salt, err = newSalt(); err != nil {
+		return
+	}
+	var root PrivateShard
+	root, err = EncryptReader(r, revisionKey(h.readKey, int64(h.Len()), salt), w.s, NewStoreSink(ctx, st))
+	if err != nil {
+		return
+	}
+	var pub PublicShard
+	pub, err = root.PublicShard()
+	if err != nil {
+		return
+	} else if err = h.write(pub, salt); err != nil {
+		return
+	}
+	b, err = h.Marshal()
+	if err != nil {
+		return
+	} else if err = st.PutHistory(ctx, kd, b); err != nil {
+		return
+	}
+	rev = h.Len() - 1
+	return
+}
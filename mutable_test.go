@@ -0,0 +1,395 @@
+package dshards
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"reflect"
+	"testing"
+)
+
+func TestNewMDSC(t *testing.T) {
+	for _, s := range []Suite{PROTO_ZERO_SUITE, PROTO_ZERO_ED25519_SUITE, PROTO_ZERO_AEAD_SUITE} {
+		t.Run(string(s), func(t *testing.T) {
+			testNewMDSC(t, s)
+		})
+	}
+}
+
+func testNewMDSC(t *testing.T, s Suite) {
+	ctx := context.Background()
+	c, dk, priv, err := NewMDSC(s, rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+
+	parsed, err := ParseMDSC(c.String())
+	if err != nil {
+		t.Fatalf("got parse error: %s", err)
+	}
+	w, ok := parsed.(*mdsc)
+	if !ok {
+		t.Fatalf("got %T, want %T", parsed, w)
+	} else if w.a != writeAL {
+		t.Errorf("got %q, want %q", w.a, writeAL)
+	}
+
+	st := NewMemoryStore()
+	sink := NewStoreSink(ctx, st)
+	for _, p := range priv {
+		if err = sink.Put(p); err != nil {
+			t.Fatalf("got put error: %s", err)
+		}
+	}
+	u, err := c.KeyDataURN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	idsc := IDSC{s: w.s, hash: u.hash, symmKey: w.keyDataSymmKey}
+	b, err := DecryptAll(ctx, idsc, st)
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	}
+	got := NewDecryptedKeyData(w.writeKey, w.s)
+	if err = got.Unmarshal(b); err != nil {
+		t.Fatalf("got unmarshal error: %s", err)
+	} else if !reflect.DeepEqual(got.vk, dk.vk) {
+		t.Errorf("got different public key")
+	} else if !reflect.DeepEqual(got.wk.Public(), dk.vk) {
+		t.Errorf("got different private key")
+	}
+
+	h := got.NewHistory()
+	if h.Len() != 0 {
+		t.Fatalf("got len %d, want 0", h.Len())
+	}
+	pub, err := priv[0].PublicShard()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if err = h.Write(pub); err != nil {
+		t.Fatalf("got write error: %s", err)
+	} else if err = h.Verify(0); err != nil {
+		t.Errorf("got verify error: %s", err)
+	}
+	r := parsed.(ReadWriteCap).ReadCap().(*readMDSC)
+	if !bytes.Equal(r.readKey, h.readKey) {
+		t.Errorf("got read key %v, want %v", h.readKey, r.readKey)
+	}
+}
+
+// newTestMDSC creates a mutable datashard whose keydata is stored, publishing
+// a revision for each of the contents.
+func newTestMDSC(t *testing.T, contents ...[]byte) (ReadWriteCap, *MemoryStore) {
+	ctx := context.Background()
+	c, _, priv, err := NewMDSC(PROTO_ZERO_SUITE, rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	st := NewMemoryStore()
+	sink := NewStoreSink(ctx, st)
+	for _, p := range priv {
+		if err = sink.Put(p); err != nil {
+			t.Fatalf("got put error: %s", err)
+		}
+	}
+	for i, content := range contents {
+		rev, err := Publish(ctx, c, bytes.NewReader(content), st)
+		if err != nil {
+			t.Fatalf("got publish error: %s", err)
+		} else if rev != i {
+			t.Fatalf("got rev %d, want %d", rev, i)
+		}
+	}
+	return c, st
+}
+
+// readTestHistory obtains the stored History of a mutable datashard.
+func readTestHistory(t *testing.T, c ReadWriteCap, st *MemoryStore) *HistoryReadOnly {
+	v, readKey, err := readCapParts(c)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	h, err := fetchVerifiedHistory(context.Background(), v, readKey, st)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	return h
+}
+
+func TestResolveLatest(t *testing.T) {
+	first := []byte("first revision")
+	second := []byte("second revision")
+	c, f := newTestMDSC(t, first, second)
+	firstURN, err := readTestHistory(t, c, f).ReadURN(0)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	pin := func(n int, hash []byte) ReadCap {
+		return c.ReadCap().AtVersion(n, hash).(ReadCap)
+	}
+	tests := []struct {
+		name          string
+		c             ReadCap
+		expectRev     int
+		expectContent []byte
+		expectErr     bool
+	}{
+		{
+			name:          "Latest From ReadWriteCap",
+			c:             c,
+			expectRev:     1,
+			expectContent: second,
+		},
+		{
+			name:          "Latest From ReadCap",
+			c:             c.ReadCap(),
+			expectRev:     1,
+			expectContent: second,
+		},
+		{
+			name:          "Pinned Revision",
+			c:             pin(0, nil),
+			expectRev:     0,
+			expectContent: first,
+		},
+		{
+			name:          "Pinned Revision And Hash",
+			c:             pin(0, firstURN.hash),
+			expectRev:     0,
+			expectContent: first,
+		},
+		{
+			name:      "Pinned Revision With Wrong Hash",
+			c:         pin(1, firstURN.hash),
+			expectErr: true,
+		},
+		{
+			name:      "Pinned Revision Out Of Range",
+			c:         pin(2, nil),
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev, content, err := ResolveLatest(context.Background(), test.c, f)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("got no error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if rev != test.expectRev {
+				t.Errorf("got rev %d, want %d", rev, test.expectRev)
+			} else if !bytes.Equal(content, test.expectContent) {
+				t.Errorf("got %q, want %q", content, test.expectContent)
+			}
+		})
+	}
+}
+
+func TestResolveLatestBadSignature(t *testing.T) {
+	ctx := context.Background()
+	c, f := newTestMDSC(t, []byte("content"))
+	h := readTestHistory(t, c, f)
+	h.revsigs[0].sig[0] ^= 0xff
+	b, err := h.Marshal()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	}
+	kd, err := c.KeyDataURN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if err = f.PutHistory(ctx, kd, b); err != nil {
+		t.Fatalf("got put error: %s", err)
+	}
+	if _, _, err = ResolveLatest(ctx, c, f); err == nil {
+		t.Errorf("got no error, want one")
+	} else if _, err = Publish(ctx, c, bytes.NewReader([]byte("more")), f); err == nil {
+		t.Errorf("got no publish error, want one")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	c, st := newTestMDSC(t)
+	for i, content := range [][]byte{[]byte("one"), testContent(70000), []byte("three")} {
+		rev, err := Publish(ctx, c, bytes.NewReader(content), st)
+		if err != nil {
+			t.Fatalf("got publish error: %s", err)
+		} else if rev != i {
+			t.Errorf("got rev %d, want %d", rev, i)
+		}
+		rev, got, err := ResolveLatest(ctx, c.ReadCap(), st)
+		if err != nil {
+			t.Fatalf("got resolve error: %s", err)
+		} else if rev != i {
+			t.Errorf("got resolved rev %d, want %d", rev, i)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("got len %d, want len %d", len(got), len(content))
+		}
+	}
+}
+
+func TestFetchHistory(t *testing.T) {
+	ctx := context.Background()
+	c, f := newTestMDSC(t, []byte("first"), []byte("second"))
+	expect := readTestHistory(t, c, f)
+	h := readTestHistory(t, c, f)
+	h.revsigs[1].sig[0] ^= 0xff
+	b, err := h.Marshal()
+	if err != nil {
+		t.Fatalf("got marshal error: %s", err)
+	}
+	kd, err := c.KeyDataURN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if err = f.PutHistory(ctx, kd, b); err != nil {
+		t.Fatalf("got put error: %s", err)
+	}
+
+	v, err := FetchHistory(ctx, c.VerifyCap(), f)
+	if err != nil {
+		t.Fatalf("got fetch error: %s", err)
+	} else if v.Len() != 2 {
+		t.Fatalf("got len %d, want 2", v.Len())
+	} else if err = v.Verify(0); err != nil {
+		t.Errorf("got verify error for revision 0: %s", err)
+	} else if err = v.Verify(1); err == nil {
+		t.Errorf("got no verify error for tampered revision 1")
+	}
+
+	r, err := FetchReadableHistory(ctx, c.ReadCap(), f)
+	if err != nil {
+		t.Fatalf("got fetch error: %s", err)
+	}
+	for i := 0; i < expect.Len(); i++ {
+		got, err := r.ReadURN(i)
+		if err != nil {
+			t.Fatalf("got read error: %s", err)
+		}
+		want, err := expect.ReadURN(i)
+		if err != nil {
+			t.Fatalf("got read error: %s", err)
+		} else if got.String() != want.String() {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestFetchHistoryNotPublished(t *testing.T) {
+	ctx := context.Background()
+	c, f := newTestMDSC(t)
+	v, err := FetchHistory(ctx, c.VerifyCap(), f)
+	if err != nil {
+		t.Fatalf("got fetch error: %s", err)
+	} else if v.Len() != 0 {
+		t.Errorf("got len %d, want 0", v.Len())
+	}
+	r, err := FetchReadableHistory(ctx, c.ReadCap(), f)
+	if err != nil {
+		t.Fatalf("got fetch error: %s", err)
+	} else if r.Len() != 0 {
+		t.Errorf("got len %d, want 0", r.Len())
+	}
+	if _, _, err = ResolveLatest(ctx, c.ReadCap(), f); err == nil {
+		t.Errorf("got no error, want one")
+	} else if err == ErrNotFound {
+		t.Errorf("got %v, want an error for no revisions", err)
+	}
+}
+
+func TestPublishRevisionKeys(t *testing.T) {
+	ctx := context.Background()
+	c, _, priv, err := NewMDSC(Suite(testTreeSuiteName), rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	st := NewMemoryStore()
+	sink := NewStoreSink(ctx, st)
+	for _, p := range priv {
+		if err = sink.Put(p); err != nil {
+			t.Fatalf("got put error: %s", err)
+		}
+	}
+	testTreeSuiteImpl.reset()
+	defer testTreeSuiteImpl.reset()
+	content := testContent(2000)
+	for i := 0; i < 2; i++ {
+		if _, err = Publish(ctx, c, bytes.NewReader(content), st); err != nil {
+			t.Fatalf("got publish error: %s", err)
+		}
+	}
+	for iv, count := range testTreeSuiteImpl.ivs {
+		if count != 1 {
+			t.Errorf("got iv %x used %d times, want once", iv, count)
+		}
+	}
+	h, err := FetchReadableHistory(ctx, c.ReadCap(), st)
+	if err != nil {
+		t.Fatalf("got fetch error: %s", err)
+	}
+	first, err := h.ReadIDSC(0)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	second, err := h.ReadIDSC(1)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if bytes.Equal(first.symmKey, second.symmKey) {
+		t.Errorf("got the same key for both revisions")
+	}
+	for i, ic := range []IDSC{first, second} {
+		got, err := DecryptAll(ctx, ic, st)
+		if err != nil {
+			t.Fatalf("got decrypt error for revision %d: %s", i, err)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("got len %d for revision %d, want len %d", len(got), i, len(content))
+		}
+	}
+}
+
+func TestPublishSameRevisionKeys(t *testing.T) {
+	ctx := context.Background()
+	c, _, priv, err := NewMDSC(Suite(testTreeSuiteName), rand.Reader)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	content := testContent(2000)
+	var keys []SymmetricKey
+	// Each store begins without a History, as racing publishers do.
+	for i := 0; i < 2; i++ {
+		st := NewMemoryStore()
+		sink := NewStoreSink(ctx, st)
+		for _, p := range priv {
+			if err = sink.Put(p); err != nil {
+				t.Fatalf("got put error: %s", err)
+			}
+		}
+		rev, err := Publish(ctx, c, bytes.NewReader(content), st)
+		if err != nil {
+			t.Fatalf("got publish error: %s", err)
+		} else if rev != 0 {
+			t.Fatalf("got revision %d, want 0", rev)
+		}
+		h, err := FetchReadableHistory(ctx, c.ReadCap(), st)
+		if err != nil {
+			t.Fatalf("got fetch error: %s", err)
+		}
+		ic, err := h.ReadIDSC(0)
+		if err != nil {
+			t.Fatalf("got error: %s", err)
+		}
+		got, err := DecryptAll(ctx, ic, st)
+		if err != nil {
+			t.Fatalf("got decrypt error: %s", err)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("got len %d, want len %d", len(got), len(content))
+		}
+		keys = append(keys, ic.symmKey)
+	}
+	if bytes.Equal(keys[0], keys[1]) {
+		t.Errorf("got the same key for both publishes of revision 0")
+	}
+}
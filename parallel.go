@@ -0,0 +1,121 @@
+package dshards
+
+import (
+	"sync"
+)
+
+// Parallel Chunk Processing
+//
+// The IV of each chunk depends only on its counter, so chunks are encrypted
+// and decrypted independently of one another. The shards are still given to
+// the sink, and decrypted content still assembled, in the order of the
+// manifest, so the output does not depend on the number of workers.
+
+// chunkEncrypter encrypts chunks with up to workers at once, putting each
+// encrypted shard to the sink in the order the chunks were added.
+type chunkEncrypter struct {
+	key     SymmetricKey
+	s       Suite
+	workers int
+	// put receives each encrypted shard, in order.
+	put func(p PrivateShard) error
+	// The chunks being encrypted, oldest first.
+	pending []*encryptJob
+}
+
+// encryptJob is a chunk being encrypted. The result is ready once done is
+// closed.
+type encryptJob struct {
+	p    PrivateShard
+	err  error
+	done chan struct{}
+}
+
+func newChunkEncrypter(key SymmetricKey, s Suite, workers int, put func(p PrivateShard) error) *chunkEncrypter {
+	return &chunkEncrypter{
+		key:     key,
+		s:       s,
+		workers: workers,
+		put:     put,
+	}
+}
+
+// add begins encrypting the chunk, first waiting for the oldest chunk to
+// finish if all workers are busy. With at most one worker, the chunk is
+// encrypted and put before returning.
+func (c *chunkEncrypter) add(plain []byte, ctr uint64, ivFn ivFunc) error {
+	if c.workers <= 1 {
+		p, err := encryptChunk(plain, c.key, c.s, ctr, ivFn)
+		if err != nil {
+			return err
+		}
+		return c.put(p)
+	}
+	if len(c.pending) >= c.workers {
+		if err := c.next(); err != nil {
+			return err
+		}
+	}
+	j := &encryptJob{done: make(chan struct{})}
+	go func() {
+		defer close(j.done)
+		j.p, j.err = encryptChunk(plain, c.key, c.s, ctr, ivFn)
+	}()
+	c.pending = append(c.pending, j)
+	return nil
+}
+
+// next waits for the oldest chunk to be encrypted and puts it.
+func (c *chunkEncrypter) next() error {
+	j := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	<-j.done
+	if j.err != nil {
+		return j.err
+	}
+	return c.put(j.p)
+}
+
+// flush waits for every chunk to be encrypted, putting them in order.
+func (c *chunkEncrypter) flush() error {
+	for len(c.pending) > 0 {
+		if err := c.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parallelFor calls f for each index below n, with up to workers calls at
+// once. The error of the lowest index is returned, so the result does not
+// depend on the order the calls finish in.
+func parallelFor(n, workers int, f func(i int) error) error {
+	if workers <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, n)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package dshards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errReaderClosed = errors.New("dshards: read on closed reader")
+
+var _ io.ReadCloser = new(decryptingReader)
+
+// decryptingReader lazily fetches and decrypts the content datashards listed
+// in the manifest tree, one at a time. Each manifest is fetched only when the
+// first datashard it lists is needed, except for a legacy manifest, which is
+// fetched entirely before any content.
+type decryptingReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	root   PrivateShard
+	s      Suite
+	f      Fetcher
+	// The shape of the manifest tree, and the level and URNs of the
+	// datashards listed by the root.
+	shape     treeShape
+	rootLevel int
+	rootURNs  []URN
+	// The most recently fetched manifest of each level, by level.
+	manifests []levelManifest
+	// The index of the next datashard of content to decrypt.
+	next int64
+	// The length of content not yet decrypted, used to drop padding.
+	remaining int64
+	// Decrypted content not yet read.
+	buf     []byte
+	started bool
+	err     error
+}
+
+// levelManifest is the ith manifest of a level, and the URNs it lists.
+type levelManifest struct {
+	i    int64
+	urns []URN
+}
+
+// NewDecryptingReader applies the Datashards decryption algorithm onto the
+// root Datashard, fetching and decrypting the remaining datashards as the
+// content is read.
+//
+// No more than one datashard of content, and one manifest of each level of the
+// manifest tree, is held in memory at a time. Closing the reader cancels any
+// fetch in progress.
+func NewDecryptingReader(root PrivateShard, s Suite, f Fetcher) io.ReadCloser {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &decryptingReader{
+		ctx:    ctx,
+		cancel: cancel,
+		root:   root,
+		s:      s,
+		f:      f,
+	}
+}
+
+func (d *decryptingReader) Read(p []byte) (n int, err error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.advance()
+	}
+	n = copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return
+}
+
+func (d *decryptingReader) Close() error {
+	d.cancel()
+	d.buf = nil
+	d.err = errReaderClosed
+	return nil
+}
+
+// advance decrypts the next datashard of content into the buffer.
+func (d *decryptingReader) advance() error {
+	if !d.started {
+		d.started = true
+		return d.start()
+	} else if d.rootURNs != nil && d.next < d.shape.count(0) {
+		u, err := d.urnAt(0, d.next)
+		if err != nil {
+			return err
+		}
+		ds, err := fetchDecoded(d.ctx, d.f, u, int(d.next), 0, d.root.AddressAndKey.symmKey, d.s)
+		if err != nil {
+			return err
+		} else if ds.isManifest {
+			return fmt.Errorf("malformed datashard: decrypting %dth fetched result encountered unexpected type %q", d.next, ds.tag())
+		}
+		d.next++
+		d.fill(ds.content)
+		return nil
+	} else if d.remaining > 0 {
+		return fmt.Errorf("malformed datashard: decrypting yielded %d fewer bytes than expected", d.remaining)
+	}
+	return io.EOF
+}
+
+// start decrypts the root datashard. Its manifests are left to be fetched as
+// the content they list is read.
+func (d *decryptingReader) start() error {
+	r, err := Decrypt(d.root, d.s)
+	if err != nil {
+		return err
+	} else if len(r.fetch) == 0 {
+		d.remaining = int64(len(r.content))
+		d.fill(r.content)
+		return nil
+	} else if r.legacy {
+		r, err = resolveLegacy(d.ctx, d.f, r, d.root.AddressAndKey.symmKey, d.s)
+		if err != nil {
+			return err
+		}
+	}
+	d.shape, err = newTreeShape(d.s, r.contentLen)
+	if err != nil {
+		return err
+	}
+	d.rootLevel = r.level
+	d.rootURNs = r.fetch
+	d.manifests = make([]levelManifest, r.level+1)
+	d.remaining = r.contentLen
+	return d.advance()
+}
+
+// urnAt obtains the URN of the ith datashard of the level, fetching the
+// manifest listing it if that is not the most recent one of the level above.
+func (d *decryptingReader) urnAt(level int, i int64) (URN, error) {
+	if level == d.rootLevel {
+		return d.rootURNs[i], nil
+	}
+	parent := i / d.shape.fanOut
+	m := &d.manifests[level+1]
+	if m.urns == nil || m.i != parent {
+		u, err := d.urnAt(level+1, parent)
+		if err != nil {
+			return URN{}, err
+		}
+		ds, err := fetchDecoded(d.ctx, d.f, u, int(parent), level+1, d.root.AddressAndKey.symmKey, d.s)
+		if err != nil {
+			return URN{}, err
+		}
+		urns, err := decodeManifest(ds, level+1, parent, d.shape)
+		if err != nil {
+			return URN{}, err
+		}
+		m.i = parent
+		m.urns = urns
+	}
+	return m.urns[i%d.shape.fanOut], nil
+}
+
+// fill buffers the decrypted content, dropping any beyond the expected length.
+func (d *decryptingReader) fill(c []byte) {
+	if int64(len(c)) > d.remaining {
+		c = c[:d.remaining]
+	}
+	d.remaining -= int64(len(c))
+	d.buf = c
+}
+
+// fetchDecoded fetches, verifies, decrypts, and decodes the datashard at the
+// URN, which is the ith of a level of the manifest tree.
+func fetchDecoded(ctx context.Context, f Fetcher, u URN, i, level int, key SymmetricKey, s Suite) (ds decodedShard, err error) {
+	var p PrivateShard
+	p, err = fetchShard(ctx, f, u, key, s)
+	if err != nil {
+		return
+	} else if err = verifyShard(p.Content, u, i); err != nil {
+		return
+	}
+	var pt []byte
+	pt, err = decryptChunk(p.Content, key, s, uint64(i), ivLevel(level))
+	if err != nil {
+		return
+	}
+	return decodeShard(pt)
+}
@@ -0,0 +1,97 @@
+package dshards
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecryptingReader(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name string
+		len  int
+	}{
+		{
+			name: "Empty",
+			len:  0,
+		},
+		{
+			name: "Single Shard",
+			len:  42,
+		},
+		{
+			name: "One Manifest",
+			len:  2*n + 7,
+		},
+		{
+			name: "Manifest Of Manifests",
+			len:  600 * n,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			r := NewDecryptingReader(priv[rootIdx], PROTO_ZERO_SUITE, newTestFetcher(t, priv))
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("got read error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+			if err = r.Close(); err != nil {
+				t.Errorf("got close error: %s", err)
+			} else if _, err = r.Read(make([]byte, 1)); err != errReaderClosed {
+				t.Errorf("got error %v, want %v", err, errReaderClosed)
+			}
+		})
+	}
+}
+
+func TestDecryptingReaderLazy(t *testing.T) {
+	s := Suite(testTreeSuiteName)
+	shape, err := newTreeShape(s, 0)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	n, f := int(shape.chunkLen), int(shape.fanOut)
+	plain := testContent(f*f*n + 1)
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, s)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	fetcher := &countingFetcher{testFetcher: newTestFetcher(t, priv), fetched: make(map[string]int)}
+	r := NewDecryptingReader(priv[rootIdx], s, fetcher)
+	defer r.Close()
+
+	// Only the manifests leading to the first datashard of content are
+	// fetched before it.
+	p := make([]byte, 1)
+	if _, err = r.Read(p); err != nil {
+		t.Fatalf("got read error: %s", err)
+	} else if len(fetcher.fetched) != 3 {
+		t.Errorf("got %d datashards fetched, want 3", len(fetcher.fetched))
+	}
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("got read error: %s", err)
+	} else if got := append(p, rest...); !bytes.Equal(got, plain) {
+		t.Errorf("got len %d, want len %d", len(got), len(plain))
+	}
+	if len(fetcher.fetched) != len(priv)-1 {
+		t.Errorf("got %d datashards fetched, want %d", len(fetcher.fetched), len(priv)-1)
+	}
+	for u, count := range fetcher.fetched {
+		if count != 1 {
+			t.Errorf("got %s fetched %d times, want once", u, count)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package dshards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	_ io.ReaderAt   = new(ShardFile)
+	_ io.ReadSeeker = new(ShardFile)
+)
+
+// ShardFile reads arbitrary ranges of the content of an immutable datashard.
+// Only the manifests leading to the content overlapping a read, and the
+// datashards of that content, are fetched and decrypted. This is possible
+// because each datashard is encrypted with an IV that depends only on its
+// position in the manifest tree. A legacy manifest does not record its levels,
+// so all of it is fetched when the ShardFile is created.
+//
+// ReadAt is safe for concurrent use, but Read and Seek share an offset and are
+// not.
+type ShardFile struct {
+	ctx context.Context
+	f   Fetcher
+	s   Suite
+	key SymmetricKey
+	// The content of a root datashard that is not a manifest.
+	content []byte
+	// Otherwise, the shape of the manifest tree, and the level and URNs of
+	// the datashards listed by the root.
+	shape     treeShape
+	rootLevel int
+	rootURNs  []URN
+	size      int64
+	// The offset of Read and Seek.
+	off int64
+
+	mu sync.Mutex
+	// The URNs listed by each manifest fetched so far.
+	manifests map[treePos][]URN
+	// The most recently decrypted datashard of content.
+	cacheIdx int64
+	cache    []byte
+}
+
+// treePos is the position of a datashard in the manifest tree.
+type treePos struct {
+	level int
+	i     int64
+}
+
+// NewShardFile fetches and decrypts the root datashard of the IDSC, so that
+// the content can be read in any order. The context is used for every fetch,
+// including those made by later reads.
+func NewShardFile(ctx context.Context, idsc IDSC, f Fetcher) (sf *ShardFile, err error) {
+	var u URN
+	u, err = idsc.URN()
+	if err != nil {
+		return
+	}
+	var root PrivateShard
+	root, err = fetchShard(ctx, f, u, idsc.symmKey, idsc.s)
+	if err != nil {
+		return
+	}
+	var r *Result
+	r, err = Decrypt(root, idsc.s)
+	if err != nil {
+		return
+	} else if r.legacy {
+		r, err = resolveLegacy(ctx, f, r, idsc.symmKey, idsc.s)
+		if err != nil {
+			return
+		}
+	}
+	sf = &ShardFile{
+		ctx:       ctx,
+		f:         f,
+		s:         idsc.s,
+		key:       idsc.symmKey,
+		manifests: make(map[treePos][]URN),
+		cacheIdx:  -1,
+	}
+	if len(r.fetch) == 0 {
+		sf.content = r.content
+		sf.size = int64(len(r.content))
+		return
+	}
+	sf.shape, err = newTreeShape(idsc.s, r.contentLen)
+	if err != nil {
+		return nil, err
+	}
+	sf.rootLevel = r.level
+	sf.rootURNs = r.fetch
+	sf.size = r.contentLen
+	return
+}
+
+// Size is the length of the content.
+func (sf *ShardFile) Size() int64 {
+	return sf.size
+}
+
+// ReadAt reads len(p) bytes of content starting at the offset, fetching and
+// decrypting only the datashards that hold them.
+func (sf *ShardFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("dshards: read at negative offset")
+	} else if off >= sf.size {
+		return 0, io.EOF
+	}
+	for n < len(p) && off < sf.size {
+		var c []byte
+		c, err = sf.chunkAt(off)
+		if err != nil {
+			return
+		}
+		m := copy(p[n:], c)
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// chunkAt obtains the content from the offset to the end of the datashard
+// holding it.
+func (sf *ShardFile) chunkAt(off int64) ([]byte, error) {
+	if sf.rootURNs == nil {
+		return sf.content[off:], nil
+	}
+	idx := off / sf.shape.chunkLen
+	start := idx * sf.shape.chunkLen
+	want := sf.shape.sizeAt(0, idx)
+	c, err := sf.decryptLeaf(idx)
+	if err != nil {
+		return nil, err
+	} else if int64(len(c)) < want {
+		return nil, fmt.Errorf("malformed datashard: decrypting %dth datashard of content yielded %d of %d bytes", idx, len(c), want)
+	}
+	return c[off-start : want], nil
+}
+
+// decryptLeaf obtains the decrypted content of the ith datashard of content.
+func (sf *ShardFile) decryptLeaf(i int64) ([]byte, error) {
+	sf.mu.Lock()
+	if sf.cacheIdx == i {
+		c := sf.cache
+		sf.mu.Unlock()
+		return c, nil
+	}
+	sf.mu.Unlock()
+	u, err := sf.urnAt(treePos{level: 0, i: i})
+	if err != nil {
+		return nil, err
+	}
+	ds, err := fetchDecoded(sf.ctx, sf.f, u, int(i), 0, sf.key, sf.s)
+	if err != nil {
+		return nil, err
+	} else if ds.isManifest {
+		return nil, fmt.Errorf("malformed datashard: decrypting %dth datashard of content encountered unexpected type %q", i, ds.tag())
+	}
+	sf.mu.Lock()
+	sf.cacheIdx = i
+	sf.cache = ds.content
+	sf.mu.Unlock()
+	return ds.content, nil
+}
+
+// urnAt obtains the URN of the datashard at the position, fetching the
+// manifests above it as needed.
+func (sf *ShardFile) urnAt(pos treePos) (URN, error) {
+	if pos.level == sf.rootLevel {
+		return sf.rootURNs[pos.i], nil
+	}
+	parent := treePos{level: pos.level + 1, i: pos.i / sf.shape.fanOut}
+	urns, err := sf.manifest(parent)
+	if err != nil {
+		return URN{}, err
+	}
+	return urns[pos.i%sf.shape.fanOut], nil
+}
+
+// manifest obtains the URNs listed by the manifest at the position.
+func (sf *ShardFile) manifest(pos treePos) ([]URN, error) {
+	sf.mu.Lock()
+	urns, ok := sf.manifests[pos]
+	sf.mu.Unlock()
+	if ok {
+		return urns, nil
+	}
+	u, err := sf.urnAt(pos)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := fetchDecoded(sf.ctx, sf.f, u, int(pos.i), pos.level, sf.key, sf.s)
+	if err != nil {
+		return nil, err
+	}
+	urns, err = decodeManifest(ds, pos.level, pos.i, sf.shape)
+	if err != nil {
+		return nil, err
+	}
+	sf.mu.Lock()
+	sf.manifests[pos] = urns
+	sf.mu.Unlock()
+	return urns, nil
+}
+
+// Read reads content from the current offset, advancing it.
+func (sf *ShardFile) Read(p []byte) (n int, err error) {
+	n, err = sf.ReadAt(p, sf.off)
+	sf.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// Seek sets the offset of the next Read, interpreted according to whence as
+// in io.Seeker.
+func (sf *ShardFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sf.off
+	case io.SeekEnd:
+		offset += sf.size
+	default:
+		return 0, fmt.Errorf("dshards: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("dshards: seek to negative offset")
+	}
+	sf.off = offset
+	return offset, nil
+}
@@ -0,0 +1,180 @@
+package dshards
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// countingFetcher is a testFetcher that counts the fetches of each URN.
+type countingFetcher struct {
+	testFetcher
+	fetched map[string]int
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, u URN) ([]byte, error) {
+	f.fetched[u.String()]++
+	return f.testFetcher.Fetch(ctx, u)
+}
+
+func TestShardFileReadAt(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	plain := testContent(5*n + 17)
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	tests := []struct {
+		name string
+		off  int64
+		len  int
+		// The datashards of content expected to be fetched.
+		expectFetched []int
+		expectEOF     bool
+	}{
+		{
+			name:          "Within First",
+			off:           10,
+			len:           100,
+			expectFetched: []int{0},
+		},
+		{
+			name:          "Within Middle",
+			off:           int64(2*n + 5),
+			len:           100,
+			expectFetched: []int{2},
+		},
+		{
+			name:          "Spanning",
+			off:           int64(3*n - 5),
+			len:           10,
+			expectFetched: []int{2, 3},
+		},
+		{
+			name:          "Final",
+			off:           int64(5 * n),
+			len:           17,
+			expectFetched: []int{5},
+		},
+		{
+			name:          "Past End",
+			off:           int64(5*n + 10),
+			len:           100,
+			expectFetched: []int{5},
+			expectEOF:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &countingFetcher{testFetcher: newTestFetcher(t, priv), fetched: make(map[string]int)}
+			sf, err := NewShardFile(context.Background(), priv[rootIdx].AddressAndKey, f)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if sf.Size() != int64(len(plain)) {
+				t.Fatalf("got size %d, want %d", sf.Size(), len(plain))
+			}
+			p := make([]byte, test.len)
+			got, err := sf.ReadAt(p, test.off)
+			if test.expectEOF && err != io.EOF {
+				t.Errorf("got error %v, want %v", err, io.EOF)
+			} else if !test.expectEOF && err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			expect := plain[test.off:]
+			if len(expect) > test.len {
+				expect = expect[:test.len]
+			}
+			if !bytes.Equal(p[:got], expect) {
+				t.Errorf("got %q, want %q", p[:got], expect)
+			}
+
+			// Content is in the first six shards, followed by the
+			// manifest.
+			for i := 0; i < 6; i++ {
+				u, err := priv[i].AddressAndKey.URN()
+				if err != nil {
+					t.Fatalf("got error: %s", err)
+				}
+				expectCount := 0
+				for _, e := range test.expectFetched {
+					if e == i {
+						expectCount = 1
+					}
+				}
+				if got := f.fetched[u.String()]; got != expectCount {
+					t.Errorf("got %d fetches of shard %d, want %d", got, i, expectCount)
+				}
+			}
+		})
+	}
+}
+
+func TestShardFileReadSeek(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize-chacha20poly1305.Overhead)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name  string
+		len   int
+		suite Suite
+	}{
+		{
+			name:  "Single Shard",
+			len:   42,
+			suite: PROTO_ZERO_SUITE,
+		},
+		{
+			name:  "Empty",
+			len:   0,
+			suite: PROTO_ZERO_SUITE,
+		},
+		{
+			name:  "Manifest Of Manifests",
+			len:   600*n + 1,
+			suite: PROTO_ZERO_AEAD_SUITE,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv, err := EncryptOptions{VariadicChunks: true}.Encrypt(plain, testSymmKey, test.suite)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			sf, err := NewShardFile(context.Background(), priv[rootIdx].AddressAndKey, newTestFetcher(t, priv))
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			got, err := ioutil.ReadAll(sf)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+
+			off, err := sf.Seek(-int64(test.len/2), io.SeekEnd)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if off != int64(test.len-test.len/2) {
+				t.Errorf("got offset %d, want %d", off, test.len-test.len/2)
+			}
+			got, err = ioutil.ReadAll(sf)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if !bytes.Equal(got, plain[off:]) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain[off:]))
+			}
+			if _, err = sf.Seek(-1, io.SeekStart); err == nil {
+				t.Errorf("got no error seeking before the start")
+			}
+		})
+	}
+}
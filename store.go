@@ -0,0 +1,163 @@
+package dshards
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound indicates that a Store does not have a Datashard at a URN.
+var ErrNotFound = errors.New("dshards: datashard not found")
+
+// Store persists the encrypted content of Datashards by their URN.
+//
+// A Store is also a Fetcher, so that the Datashards put into it can be fed
+// straight back into decryption.
+type Store interface {
+	Fetcher
+	// Put stores the Datashard, replacing any already at its URN.
+	Put(ctx context.Context, p PublicShard) error
+	// Get obtains the Datashard at the URN, or returns ErrNotFound.
+	Get(ctx context.Context, u URN) (PublicShard, error)
+	// Has determines whether a Datashard is stored at the URN.
+	Has(ctx context.Context, u URN) (bool, error)
+	// Delete removes the Datashard at the URN, if there is one.
+	Delete(ctx context.Context, u URN) error
+	// List obtains the URNs of all stored Datashards.
+	List(ctx context.Context) ([]URN, error)
+}
+
+// HistoryStore is a Store that also persists the latest History of mutable
+// datashards, located by the URN of their keydata.
+type HistoryStore interface {
+	Store
+	// FetchHistory obtains the serialized History, or returns
+	// ErrNotFound.
+	FetchHistory(ctx context.Context, keyData URN) ([]byte, error)
+	// PutHistory stores the serialized History, replacing any previous
+	// one.
+	PutHistory(ctx context.Context, keyData URN, b []byte) error
+}
+
+var _ ShardSink = new(storeSink)
+
+// storeSink puts each encrypted Datashard into a Store.
+type storeSink struct {
+	ctx context.Context
+	st  Store
+}
+
+// NewStoreSink adapts a Store into a ShardSink, so that Datashards are
+// persisted as they are encrypted.
+func NewStoreSink(ctx context.Context, st Store) ShardSink {
+	return &storeSink{ctx: ctx, st: st}
+}
+
+func (s *storeSink) Put(p PrivateShard) error {
+	pub, err := p.PublicShard()
+	if err != nil {
+		return err
+	}
+	return s.st.Put(s.ctx, pub)
+}
+
+var _ HistoryStore = new(MemoryStore)
+
+// MemoryStore is a HistoryStore that keeps Datashards and Histories in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	shards    map[string]PublicShard
+	histories map[string][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		shards:    make(map[string]PublicShard),
+		histories: make(map[string][]byte),
+	}
+}
+
+func (m *MemoryStore) Put(ctx context.Context, p PublicShard) error {
+	c := make([]byte, len(p.Content))
+	copy(c, p.Content)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shards[p.Address.String()] = PublicShard{
+		Content: c,
+		Address: p.Address,
+	}
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, u URN) (p PublicShard, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.shards[u.String()]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	p.Address = s.Address
+	p.Content = make([]byte, len(s.Content))
+	copy(p.Content, s.Content)
+	return
+}
+
+func (m *MemoryStore) Fetch(ctx context.Context, u URN) ([]byte, error) {
+	p, err := m.Get(ctx, u)
+	return p.Content, err
+}
+
+func (m *MemoryStore) Has(ctx context.Context, u URN) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.shards[u.String()]
+	return ok, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, u URN) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.shards, u.String())
+	return nil
+}
+
+// List obtains the URNs of all stored Datashards, sorted by their string form.
+func (m *MemoryStore) List(ctx context.Context) ([]URN, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.shards))
+	for k := range m.shards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	urns := make([]URN, len(keys))
+	for i, k := range keys {
+		urns[i] = m.shards[k].Address
+	}
+	return urns, nil
+}
+
+func (m *MemoryStore) FetchHistory(ctx context.Context, keyData URN) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.histories[keyData.String()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	b := make([]byte, len(h))
+	copy(b, h)
+	return b, nil
+}
+
+func (m *MemoryStore) PutHistory(ctx context.Context, keyData URN, b []byte) error {
+	h := make([]byte, len(b))
+	copy(h, b)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histories[keyData.String()] = h
+	return nil
+}
@@ -0,0 +1,105 @@
+package dshards
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dshards-store")
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name string
+		st   HistoryStore
+	}{
+		{
+			name: "MemoryStore",
+			st:   NewMemoryStore(),
+		},
+		{
+			name: "DirStore",
+			st:   NewDirStore(dir),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			plain := testContent(2*n + 1)
+			root, err := EncryptReader(bytes.NewReader(plain), testSymmKey, PROTO_ZERO_SUITE, NewStoreSink(ctx, test.st))
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			got, err := DecryptAll(ctx, root.AddressAndKey, test.st)
+			if err != nil {
+				t.Fatalf("got decrypt error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+
+			urns, err := test.st.List(ctx)
+			if err != nil {
+				t.Fatalf("got list error: %s", err)
+			} else if len(urns) != 4 {
+				t.Errorf("got %d urns, want %d", len(urns), 4)
+			}
+
+			u, err := root.AddressAndKey.URN()
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if p, err := test.st.Get(ctx, u); err != nil {
+				t.Errorf("got get error: %s", err)
+			} else if !bytes.Equal(p.Content, root.Content) {
+				t.Errorf("got different content")
+			} else if p.Address.String() != u.String() {
+				t.Errorf("got %s, want %s", p.Address, u)
+			}
+			if ok, err := test.st.Has(ctx, u); err != nil {
+				t.Errorf("got has error: %s", err)
+			} else if !ok {
+				t.Errorf("got %v, want %v", ok, true)
+			}
+
+			if err = test.st.Delete(ctx, u); err != nil {
+				t.Errorf("got delete error: %s", err)
+			} else if err = test.st.Delete(ctx, u); err != nil {
+				t.Errorf("got second delete error: %s", err)
+			}
+			if ok, err := test.st.Has(ctx, u); err != nil {
+				t.Errorf("got has error: %s", err)
+			} else if ok {
+				t.Errorf("got %v, want %v", ok, false)
+			}
+			if _, err = test.st.Get(ctx, u); err != ErrNotFound {
+				t.Errorf("got error %v, want %v", err, ErrNotFound)
+			}
+
+			history := []byte("[7\"history]")
+			if _, err = test.st.FetchHistory(ctx, u); err != ErrNotFound {
+				t.Errorf("got error %v, want %v", err, ErrNotFound)
+			} else if err = test.st.PutHistory(ctx, u, history); err != nil {
+				t.Errorf("got put history error: %s", err)
+			} else if got, err := test.st.FetchHistory(ctx, u); err != nil {
+				t.Errorf("got fetch history error: %s", err)
+			} else if !bytes.Equal(got, history) {
+				t.Errorf("got %s, want %s", got, history)
+			}
+			if urns, err = test.st.List(ctx); err != nil {
+				t.Fatalf("got list error: %s", err)
+			} else if len(urns) != 3 {
+				t.Errorf("got %d urns, want %d", len(urns), 3)
+			}
+		})
+	}
+}
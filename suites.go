@@ -4,7 +4,17 @@ import (
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // Suite of encryption protocols supported by Datashards.
@@ -12,56 +22,367 @@ type Suite string
 
 const (
 	PROTO_ZERO_SUITE Suite = "0p"
+	// PROTO_ZERO_ED25519_SUITE is the same as PROTO_ZERO_SUITE, except that
+	// mutable datashard revisions are signed with Ed25519 instead of RSA.
+	PROTO_ZERO_ED25519_SUITE Suite = "0pe"
+	// PROTO_ZERO_AEAD_SUITE authenticates everything it encrypts with
+	// XChaCha20-Poly1305 instead of AES-CTR, so tampered ciphertext fails
+	// to decrypt with ErrAuthentication. Revisions are signed with Ed25519.
+	PROTO_ZERO_AEAD_SUITE Suite = "0pa"
+)
+
+// SuiteImpl implements the cryptography of a Suite.
+//
+// Signing keys must be either an *rsa.PrivateKey or an ed25519.PrivateKey, so
+// that they can be stored in the keydata of a mutable datashard.
+type SuiteImpl interface {
+	// URNHash is the hash algorithm of the URN addressing encrypted
+	// content.
+	URNHash() Hash
+	// DeriveIV derives the initialization vector of a Datashard from
+	// material unique to its key and position.
+	DeriveIV(material []byte) []byte
+	// Overhead is the number of bytes that EncryptShard adds to the
+	// plaintext.
+	Overhead() int
+	// EncryptShard encrypts the plaintext of a Datashard.
+	EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error)
+	// DecryptShard decrypts the ciphertext of a Datashard.
+	DecryptShard(ciphertext []byte, key SymmetricKey, iv []byte) ([]byte, error)
+	// WrapKey encrypts the private signing key in the keydata of a
+	// mutable datashard.
+	WrapKey(plain []byte, key SymmetricKey) ([]byte, error)
+	// UnwrapKey decrypts the private signing key in the keydata of a
+	// mutable datashard.
+	UnwrapKey(wrapped []byte, key SymmetricKey) ([]byte, error)
+	// EncryptLocation encrypts the URN of a revision in a History,
+	// returning the IV it used.
+	EncryptLocation(plain []byte, key SymmetricKey) (enc, iv []byte, err error)
+	// DecryptLocation decrypts the URN of a revision in a History.
+	DecryptLocation(enc, iv []byte, key SymmetricKey) ([]byte, error)
+	// GenerateSigningKey creates a new private key for signing revisions.
+	GenerateSigningKey(rand io.Reader) (crypto.Signer, error)
+	// CheckSigningKey returns an error if the public key is not of the
+	// type that this suite signs revisions with.
+	CheckSigningKey(pub crypto.PublicKey) error
+	// SignRevision signs a revision in a History.
+	SignRevision(priv crypto.Signer, revision []byte) ([]byte, error)
+	// VerifyRevision verifies the signature of a revision in a History.
+	VerifyRevision(pub crypto.PublicKey, revision, sig []byte) error
+}
+
+var (
+	suitesMu sync.RWMutex
+	suites   = make(map[Suite]SuiteImpl)
 )
 
+func init() {
+	RegisterSuite(string(PROTO_ZERO_SUITE), protoZeroSuite{
+		urnHash:        SHA256D,
+		shardCrypter:   aesCTR{},
+		revisionSigner: rsaSigner{bits: mdscSigningKeyBits},
+	})
+	RegisterSuite(string(PROTO_ZERO_ED25519_SUITE), protoZeroSuite{
+		urnHash:        SHA256D,
+		shardCrypter:   aesCTR{},
+		revisionSigner: ed25519Signer{},
+	})
+	RegisterSuite(string(PROTO_ZERO_AEAD_SUITE), protoZeroSuite{
+		urnHash:        SHA256D,
+		shardCrypter:   xChaCha20Poly1305{},
+		revisionSigner: ed25519Signer{},
+	})
+}
+
+// RegisterSuite makes a Suite available by name, so that capabilities using
+// it can be parsed and their Datashards encrypted and decrypted.
+//
+// The name appears in capabilities, so it may not be empty nor contain a "."
+// or ":". RegisterSuite panics if the name is invalid, if impl is nil, or if
+// the name is already registered. It is intended to be called from init.
+func RegisterSuite(name string, impl SuiteImpl) {
+	if name == "" || strings.ContainsAny(name, idscDelim+protocolDelim) {
+		panic(fmt.Sprintf("dshards: invalid suite name %q", name))
+	} else if impl == nil {
+		panic("dshards: RegisterSuite impl is nil")
+	}
+	suitesMu.Lock()
+	defer suitesMu.Unlock()
+	if _, dup := suites[Suite(name)]; dup {
+		panic(fmt.Sprintf("dshards: RegisterSuite called twice for suite %q", name))
+	}
+	suites[Suite(name)] = impl
+}
+
 // toSuite converts a string into a Suite type.
 func toSuite(s string) (su Suite, err error) {
-	switch s {
-	case string(PROTO_ZERO_SUITE):
-		su = PROTO_ZERO_SUITE
-	default:
-		err = fmt.Errorf("unknown datashards suite %q", s)
-	}
+	su = Suite(s)
+	_, err = su.impl()
 	return
 }
 
+// impl looks up the implementation of this suite.
+func (s Suite) impl() (SuiteImpl, error) {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+	impl, ok := suites[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown datashards suite %q", s)
+	}
+	return impl, nil
+}
+
 // urnHash retrieves this suite's datashards hash algorithm.
 func (s Suite) urnHash() (h Hash, err error) {
-	switch s {
-	case PROTO_ZERO_SUITE:
-		h = SHA256D
-	default:
-		err = fmt.Errorf("unknown datashards suite %q", s)
+	var impl SuiteImpl
+	impl, err = s.impl()
+	if err != nil {
+		return
 	}
+	h = impl.URNHash()
 	return
 }
 
-func (s Suite) ivHash() (h crypto.Hash, err error) {
-	switch s {
-	case PROTO_ZERO_SUITE:
-		h = crypto.SHA256
-	default:
-		err = fmt.Errorf("unknown datashards suite %q", s)
+// Built-in suites
+
+type shardCrypter interface {
+	DeriveIV(material []byte) []byte
+	Overhead() int
+	EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error)
+	DecryptShard(ciphertext []byte, key SymmetricKey, iv []byte) ([]byte, error)
+	WrapKey(plain []byte, key SymmetricKey) ([]byte, error)
+	UnwrapKey(wrapped []byte, key SymmetricKey) ([]byte, error)
+	EncryptLocation(plain []byte, key SymmetricKey) (enc, iv []byte, err error)
+	DecryptLocation(enc, iv []byte, key SymmetricKey) ([]byte, error)
+}
+
+type revisionSigner interface {
+	GenerateSigningKey(rand io.Reader) (crypto.Signer, error)
+	CheckSigningKey(pub crypto.PublicKey) error
+	SignRevision(priv crypto.Signer, revision []byte) ([]byte, error)
+	VerifyRevision(pub crypto.PublicKey, revision, sig []byte) error
+}
+
+var _ SuiteImpl = protoZeroSuite{}
+
+// protoZeroSuite combines a URN hash with an encryption scheme and a signature
+// scheme.
+type protoZeroSuite struct {
+	urnHash Hash
+	shardCrypter
+	revisionSigner
+}
+
+func (p protoZeroSuite) URNHash() Hash {
+	return p.urnHash
+}
+
+// sha256IV hashes the initialization vector material, truncating it to size.
+func sha256IV(material []byte, size int) []byte {
+	h := sha256.Sum256(material)
+	return h[:size]
+}
+
+var _ shardCrypter = aesCTR{}
+
+// aesCTR encrypts with AES-CTR, which does not authenticate.
+type aesCTR struct{}
+
+func (aesCTR) DeriveIV(material []byte) []byte {
+	return sha256IV(material, aes.BlockSize)
+}
+
+func (aesCTR) Overhead() int {
+	return 0
+}
+
+func (aesCTR) EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	return aesCTRXOR(plain, key, iv)
+}
+
+func (aesCTR) DecryptShard(ciphertext []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	return aesCTRXOR(ciphertext, key, iv)
+}
+
+func (aesCTR) WrapKey(plain []byte, key SymmetricKey) ([]byte, error) {
+	// Zeroed IV
+	return aesCTRXOR(plain, key, make([]byte, aes.BlockSize))
+}
+
+func (aesCTR) UnwrapKey(wrapped []byte, key SymmetricKey) ([]byte, error) {
+	// Zeroed IV
+	return aesCTRXOR(wrapped, key, make([]byte, aes.BlockSize))
+}
+
+func (aesCTR) EncryptLocation(plain []byte, key SymmetricKey) (enc, iv []byte, err error) {
+	iv = make([]byte, aes.BlockSize)
+	var n int
+	n, err = rand.Read(iv)
+	if err != nil {
+		return
+	} else if n != aes.BlockSize {
+		err = fmt.Errorf("crypto/rand read %d of %d bytes", n, aes.BlockSize)
+		return
 	}
+	enc, err = aesCTRXOR(plain, key, iv)
 	return
 }
 
-func (s Suite) blockCipher(key SymmetricKey) (c cipher.Block, err error) {
-	switch s {
-	case PROTO_ZERO_SUITE:
-		c, err = aes.NewCipher(key)
-	default:
-		err = fmt.Errorf("unknown datashards suite %q", s)
+func (aesCTR) DecryptLocation(enc, iv []byte, key SymmetricKey) ([]byte, error) {
+	return aesCTRXOR(enc, key, iv)
+}
+
+// aesCTRXOR applies the AES-CTR keystream to b.
+func aesCTRXOR(b []byte, key SymmetricKey, iv []byte) (out []byte, err error) {
+	var block cipher.Block
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return
+	} else if len(iv) != block.BlockSize() {
+		err = fmt.Errorf("dshards: aes-ctr iv is %d bytes, expected %d", len(iv), block.BlockSize())
+		return
 	}
+	stream := cipher.NewCTR(block, iv)
+
+	out = make([]byte, len(b))
+	stream.XORKeyStream(out, b)
 	return
 }
 
-func (s Suite) historySignatureHash() (h crypto.Hash, err error) {
-	switch s {
-	case PROTO_ZERO_SUITE:
-		h = crypto.SHA256
-	default:
-		err = fmt.Errorf("unknown datashards suite %q", s)
+var _ shardCrypter = xChaCha20Poly1305{}
+
+// xChaCha20Poly1305 encrypts with XChaCha20-Poly1305, failing to decrypt with
+// ErrAuthentication if the ciphertext was tampered with.
+type xChaCha20Poly1305 struct{}
+
+func (xChaCha20Poly1305) DeriveIV(material []byte) []byte {
+	return sha256IV(material, chacha20poly1305.NonceSizeX)
+}
+
+func (xChaCha20Poly1305) Overhead() int {
+	return chacha20poly1305.Overhead
+}
+
+func (xChaCha20Poly1305) EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	return xChaChaSeal(plain, key, iv)
+}
+
+func (xChaCha20Poly1305) DecryptShard(ciphertext []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	return xChaChaOpen(ciphertext, key, iv)
+}
+
+func (xChaCha20Poly1305) WrapKey(plain []byte, key SymmetricKey) ([]byte, error) {
+	// Zeroed nonce
+	return xChaChaSeal(plain, key, make([]byte, chacha20poly1305.NonceSizeX))
+}
+
+func (xChaCha20Poly1305) UnwrapKey(wrapped []byte, key SymmetricKey) ([]byte, error) {
+	// Zeroed nonce
+	return xChaChaOpen(wrapped, key, make([]byte, chacha20poly1305.NonceSizeX))
+}
+
+func (xChaCha20Poly1305) EncryptLocation(plain []byte, key SymmetricKey) (enc, iv []byte, err error) {
+	iv = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return
 	}
+	enc, err = xChaChaSeal(plain, key, iv)
 	return
 }
+
+func (xChaCha20Poly1305) DecryptLocation(enc, iv []byte, key SymmetricKey) ([]byte, error) {
+	return xChaChaOpen(enc, key, iv)
+}
+
+func xChaChaSeal(plain []byte, key SymmetricKey, nonce []byte) ([]byte, error) {
+	a, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	} else if len(nonce) != a.NonceSize() {
+		return nil, fmt.Errorf("dshards: xchacha20-poly1305 nonce is %d bytes, expected %d", len(nonce), a.NonceSize())
+	}
+	return a.Seal(nil, nonce, plain, nil), nil
+}
+
+func xChaChaOpen(enc []byte, key SymmetricKey, nonce []byte) ([]byte, error) {
+	a, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	} else if len(nonce) != a.NonceSize() {
+		return nil, fmt.Errorf("dshards: xchacha20-poly1305 nonce is %d bytes, expected %d", len(nonce), a.NonceSize())
+	}
+	plain, err := a.Open(nil, nonce, enc, nil)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return plain, nil
+}
+
+var _ revisionSigner = rsaSigner{}
+
+// rsaSigner signs the SHA256 hash of revisions with RSA PKCS #1 v1.5.
+type rsaSigner struct {
+	bits int
+}
+
+func (r rsaSigner) GenerateSigningKey(rand io.Reader) (crypto.Signer, error) {
+	return rsa.GenerateKey(rand, r.bits)
+}
+
+func (rsaSigner) CheckSigningKey(pub crypto.PublicKey) error {
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return fmt.Errorf("dshards: cannot sign with rsa using %T", pub)
+	}
+	return nil
+}
+
+func (rsaSigner) SignRevision(priv crypto.Signer, revision []byte) ([]byte, error) {
+	if _, ok := priv.(*rsa.PrivateKey); !ok {
+		return nil, fmt.Errorf("dshards: cannot sign with rsa using %T", priv)
+	}
+	h := sha256.Sum256(revision)
+	return priv.Sign(rand.Reader, h[:], crypto.SHA256)
+}
+
+func (rsaSigner) VerifyRevision(pub crypto.PublicKey, revision, sig []byte) error {
+	rk, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("dshards: cannot verify with rsa using %T", pub)
+	}
+	h := sha256.Sum256(revision)
+	return rsa.VerifyPKCS1v15(rk, crypto.SHA256, h[:], sig)
+}
+
+var _ revisionSigner = ed25519Signer{}
+
+// ed25519Signer signs revisions with Ed25519.
+type ed25519Signer struct{}
+
+func (ed25519Signer) GenerateSigningKey(rand io.Reader) (crypto.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand)
+	return priv, err
+}
+
+func (ed25519Signer) CheckSigningKey(pub crypto.PublicKey) error {
+	if _, ok := pub.(ed25519.PublicKey); !ok {
+		return fmt.Errorf("dshards: cannot sign with ed25519 using %T", pub)
+	}
+	return nil
+}
+
+func (ed25519Signer) SignRevision(priv crypto.Signer, revision []byte) ([]byte, error) {
+	if _, ok := priv.(ed25519.PrivateKey); !ok {
+		return nil, fmt.Errorf("dshards: cannot sign with ed25519 using %T", priv)
+	}
+	return priv.Sign(rand.Reader, revision, crypto.Hash(0))
+}
+
+func (ed25519Signer) VerifyRevision(pub crypto.PublicKey, revision, sig []byte) error {
+	ek, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("dshards: cannot verify with ed25519 using %T", pub)
+	} else if !ed25519.Verify(ek, revision, sig) {
+		return errors.New("dshards: ed25519 verification error")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package dshards
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	testSuiteName     = "test-suite"
+	testHashSuiteName = "test-blake2b"
+)
+
+// testSuite wraps a built-in suite, counting the Datashards it encrypts.
+type testSuite struct {
+	SuiteImpl
+	encrypted int
+}
+
+func (t *testSuite) EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	t.encrypted++
+	return t.SuiteImpl.EncryptShard(plain, key, iv)
+}
+
+// testHashSuite wraps a built-in suite, selecting a different URN hash.
+type testHashSuite struct {
+	SuiteImpl
+	h Hash
+}
+
+func (t testHashSuite) URNHash() Hash {
+	return t.h
+}
+
+var testSuiteImpl *testSuite
+
+func init() {
+	impl, err := PROTO_ZERO_AEAD_SUITE.impl()
+	if err != nil {
+		panic(err)
+	}
+	testSuiteImpl = &testSuite{SuiteImpl: impl}
+	RegisterSuite(testSuiteName, testSuiteImpl)
+	RegisterSuite(testHashSuiteName, testHashSuite{SuiteImpl: impl, h: BLAKE2B_256})
+}
+
+func TestRegisterSuite(t *testing.T) {
+	plain := testContent(100)
+	before := testSuiteImpl.encrypted
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, Suite(testSuiteName))
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	} else if got := testSuiteImpl.encrypted - before; got != len(priv) {
+		t.Errorf("got %d shards encrypted by the registered suite, want %d", got, len(priv))
+	}
+
+	idsc, err := ParseIDSC(priv[rootIdx].AddressAndKey.String())
+	if err != nil {
+		t.Fatalf("got parse error: %s", err)
+	} else if idsc.s != Suite(testSuiteName) {
+		t.Errorf("got suite %q, want %q", idsc.s, testSuiteName)
+	}
+	if got := decryptShards(t, rootIdx, priv, idsc.s); !bytes.Equal(got, plain) {
+		t.Errorf("got %q, want %q", got, plain)
+	}
+
+	if _, err = ParseIDSC("idsc:unregistered.X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo.eekxqfiZIcEnc8cpR-sD_3X3qLaTzQW-KnovArMkGP0"); err == nil {
+		t.Errorf("got no error parsing an unregistered suite")
+	}
+}
+
+func TestSuiteURNHash(t *testing.T) {
+	plain := testContent(100)
+	rootIdx, priv, err := Encrypt(plain, testSymmKey, Suite(testHashSuiteName))
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	}
+	u, err := priv[rootIdx].AddressAndKey.URN()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if u.dhash != BLAKE2B_256 {
+		t.Errorf("got %q, want %q", u.dhash, BLAKE2B_256)
+	}
+	if got := decryptShards(t, rootIdx, priv, Suite(testHashSuiteName)); !bytes.Equal(got, plain) {
+		t.Errorf("got %q, want %q", got, plain)
+	}
+}
+
+func TestRegisterSuitePanics(t *testing.T) {
+	impl, err := PROTO_ZERO_SUITE.impl()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name  string
+		suite string
+		impl  SuiteImpl
+	}{
+		{
+			name:  "Empty Name",
+			suite: "",
+			impl:  impl,
+		},
+		{
+			name:  "Delimiter In Name",
+			suite: "my.suite",
+			impl:  impl,
+		},
+		{
+			name:  "Nil Impl",
+			suite: "nil-suite",
+		},
+		{
+			name:  "Duplicate",
+			suite: string(PROTO_ZERO_SUITE),
+			impl:  impl,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("got no panic")
+				}
+			}()
+			RegisterSuite(test.suite, test.impl)
+		})
+	}
+}
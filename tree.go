@@ -0,0 +1,321 @@
+package dshards
+
+import (
+	"fmt"
+	"hash"
+	"math"
+	"strconv"
+)
+
+// Manifest Tree
+//
+// Content too large for a single datashard is split into datashards of
+// content, which are the leaves of a tree of manifests. Each manifest is a
+// single datashard listing the URNs of up to fan-out datashards one level
+// beneath it, where the fan-out is as many URNs of the suite's hash as fit in
+// one manifest. Every manifest but the last of its level lists exactly
+// fan-out datashards, and the root is the only manifest of the top level,
+// listing at least two. Consequently the shape of the tree is determined by
+// the length of the content alone.
+//
+// Every manifest records its level and the length of the content beneath it,
+// so decryption always knows whether it expects content or a manifest. Each
+// level of manifests is encrypted with its own IVs, so that no two datashards
+// share an IV.
+//
+// These manifests are tagged "hash-manifest". Content encrypted before the
+// tree existed has legacy "manifest" datashards instead, which concatenate URN
+// strings without recording their level, and whose parts below the root share
+// the content IVs. Legacy manifests are still decrypted, but never produced.
+
+// maxManifestLevel is the highest level of a manifest, which is far more
+// than content of any length requires.
+const maxManifestLevel = 64
+
+// manifestFanOut determines how many URNs a manifest lists, other than the
+// last manifest of a level.
+func manifestFanOut(s Suite) (n int, err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
+	if err != nil {
+		return
+	}
+	h := impl.URNHash()
+	var hh hash.Hash
+	hh, err = h.Hash()
+	if err != nil {
+		return
+	}
+	// Leave room for the largest content size and level, and an empty
+	// list of hashes.
+	var b []byte
+	b, err = encode([]interface{}{kHashManifest, constChunkSize, int64(math.MaxInt64), maxManifestLevel, string(h)}, [][]byte{})
+	if err != nil {
+		return
+	}
+	// Each hash is prefixed by its length.
+	entry := len(strconv.Itoa(hh.Size())) + 1 + hh.Size()
+	n = (constChunkSize - impl.Overhead() - len(b)) / entry
+	if n < 2 {
+		err = fmt.Errorf("dshards: manifests of suite %q cannot list more than %d urns", s, n)
+	}
+	return
+}
+
+// ivLevel generates the initialization vectors required for the datashards at
+// a level of the manifest tree, which are content at level 0.
+func ivLevel(level int) ivFunc {
+	if level == 0 {
+		return ivContent
+	}
+	return func(ctr uint64, key SymmetricKey) ([]byte, error) {
+		return generateIV(fmt.Sprintf("%s%d:", ivManifestPrefix, level), ctr, key)
+	}
+}
+
+// treeBuilder encrypts the manifest tree as the URNs of the datashards of
+// content are added, from left to right. Only the manifest being filled at
+// each level is held in memory.
+type treeBuilder struct {
+	key      SymmetricKey
+	s        Suite
+	hash     Hash
+	variadic bool
+	overhead int
+	fanOut   int
+	sink     ShardSink
+	// levels[i] is the manifest being filled at level i+1.
+	levels []*treeLevel
+}
+
+// treeLevel is the manifest being filled at a level of the tree.
+type treeLevel struct {
+	m manifest
+	// The number of manifests already encrypted at this level, which is
+	// the counter of the manifest being filled.
+	ctr uint64
+}
+
+func newTreeBuilder(key SymmetricKey, s Suite, variadic bool, overhead int, sink ShardSink) (b *treeBuilder, err error) {
+	b = &treeBuilder{
+		key:      key,
+		s:        s,
+		variadic: variadic,
+		overhead: overhead,
+		sink:     sink,
+	}
+	b.hash, err = s.urnHash()
+	if err != nil {
+		return
+	}
+	b.fanOut, err = manifestFanOut(s)
+	return
+}
+
+// add lists the datashard, holding size bytes of content, in the manifest
+// being filled at the level.
+func (b *treeBuilder) add(level int, u URN, size int64) error {
+	if len(b.levels) < level {
+		b.levels = append(b.levels, &treeLevel{m: manifest{level: level}})
+	}
+	l := b.levels[level-1]
+	// A full manifest is only encrypted once another datashard is added
+	// to its level, as only then is it known not to be the root.
+	if len(l.m.urns) == b.fanOut {
+		if err := b.encrypt(level, false); err != nil {
+			return err
+		}
+	}
+	l.m.urns = append(l.m.urns, u)
+	l.m.size += size
+	return nil
+}
+
+// encrypt encrypts the manifest being filled at the level, and adds it to
+// the level above.
+func (b *treeBuilder) encrypt(level int, final bool) error {
+	l := b.levels[level-1]
+	plain, err := l.m.Encode(b.hash, final, b.variadic, b.overhead)
+	if err != nil {
+		return err
+	}
+	p, err := encryptChunk(plain, b.key, b.s, l.ctr, ivLevel(level))
+	if err != nil {
+		return err
+	} else if err = b.sink.Put(p); err != nil {
+		return err
+	}
+	u, err := p.AddressAndKey.URN()
+	if err != nil {
+		return err
+	}
+	size := l.m.size
+	l.ctr++
+	l.m = manifest{level: level}
+	return b.add(level+1, u, size)
+}
+
+// finish encrypts the last manifest of each level, from the bottom up, ending
+// with the root.
+func (b *treeBuilder) finish() (root PrivateShard, err error) {
+	for level := 1; level <= len(b.levels); level++ {
+		l := b.levels[level-1]
+		if level < len(b.levels) || l.ctr > 0 {
+			if err = b.encrypt(level, true); err != nil {
+				return
+			}
+			continue
+		}
+		// The only manifest of the top level is the root.
+		var plain []byte
+		plain, err = l.m.Encode(b.hash, true, b.variadic, b.overhead)
+		if err != nil {
+			return
+		}
+		root, err = encryptChunk(plain, b.key, b.s, 0, ivEntryPoint)
+		if err != nil {
+			return
+		}
+		err = b.sink.Put(root)
+		return
+	}
+	err = fmt.Errorf("dshards: manifest tree has no datashards")
+	return
+}
+
+// treeShape describes the manifest tree for content of a length, in which
+// every datashard of content holds chunkLen bytes except the last, and every
+// manifest lists hashes of the same kind.
+type treeShape struct {
+	size     int64
+	chunkLen int64
+	fanOut   int64
+	hash     Hash
+}
+
+// newTreeShape describes the manifest tree for content of the length,
+// encrypted by the suite.
+func newTreeShape(s Suite, size int64) (t treeShape, err error) {
+	var impl SuiteImpl
+	impl, err = s.impl()
+	if err != nil {
+		return
+	} else if size < 0 {
+		err = fmt.Errorf("malformed datashard: negative content len %d", size)
+		return
+	}
+	var n, fanOut int
+	n, err = chunkCapacity([]interface{}{kRaw}, constChunkSize-impl.Overhead())
+	if err != nil {
+		return
+	}
+	fanOut, err = manifestFanOut(s)
+	if err != nil {
+		return
+	}
+	t = treeShape{
+		size:     size,
+		chunkLen: int64(n),
+		fanOut:   int64(fanOut),
+		hash:     impl.URNHash(),
+	}
+	return
+}
+
+// height determines the level of the root manifest, or 0 if the content fits
+// in a single datashard.
+func (t treeShape) height() (h int) {
+	for t.count(h) > 1 {
+		h++
+	}
+	return
+}
+
+// count determines how many datashards are at the level.
+func (t treeShape) count(level int) int64 {
+	n := ceilDiv(t.size, t.chunkLen)
+	for i := 0; i < level; i++ {
+		n = ceilDiv(n, t.fanOut)
+	}
+	return n
+}
+
+// ceilDiv divides the non-negative a by b, rounding up.
+func ceilDiv(a, b int64) int64 {
+	n := a / b
+	if a%b != 0 {
+		n++
+	}
+	return n
+}
+
+// span determines how many bytes of content are beneath each datashard at
+// the level, other than the last.
+func (t treeShape) span(level int) int64 {
+	s := t.chunkLen
+	for i := 0; i < level; i++ {
+		if s > t.size/t.fanOut {
+			// Larger than the content.
+			return t.size
+		}
+		s *= t.fanOut
+	}
+	return s
+}
+
+// sizeAt determines how many bytes of content are beneath the ith datashard
+// at the level.
+func (t treeShape) sizeAt(level int, i int64) int64 {
+	span := t.span(level)
+	if rest := t.size - i*span; rest < span {
+		return rest
+	}
+	return span
+}
+
+// decodeManifestLevel obtains the URNs listed by the manifests of an entire
+// level, ensuring the manifests form the tree expected for the length of the
+// content.
+func decodeManifestLevel(decoded []decodedShard, level int, shape treeShape) (urns []URN, err error) {
+	if int64(len(decoded)) != shape.count(level) {
+		err = fmt.Errorf("malformed datashard: level %d has %d manifests but expected %d", level, len(decoded), shape.count(level))
+		return
+	}
+	for i, d := range decoded {
+		var us []URN
+		us, err = decodeManifest(d, level, int64(i), shape)
+		if err != nil {
+			return
+		}
+		urns = append(urns, us...)
+	}
+	return
+}
+
+// decodeManifest obtains the URNs listed by the ith manifest of the level,
+// ensuring it is the manifest expected at that position of the tree.
+func decodeManifest(d decodedShard, level int, i int64, shape treeShape) (urns []URN, err error) {
+	if !d.isManifest || d.legacy {
+		err = fmt.Errorf("malformed datashard: expected a level %d %q but got %q", level, kHashManifest, d.tag())
+		return
+	} else if d.level != level {
+		err = fmt.Errorf("malformed datashard: expected a level %d %q but got level %d", level, kHashManifest, d.level)
+		return
+	} else if size := shape.sizeAt(level, i); d.contentLen != size {
+		err = fmt.Errorf("malformed datashard: level %d %q %d has content len %d but expected %d", level, kHashManifest, i, d.contentLen, size)
+		return
+	} else if d.hash != shape.hash {
+		err = fmt.Errorf("malformed datashard: level %d %q %d lists %q hashes but expected %q", level, kHashManifest, i, d.hash, shape.hash)
+		return
+	}
+	urns = d.urns
+	below := shape.count(level - 1)
+	expect := below - i*shape.fanOut
+	if expect > shape.fanOut {
+		expect = shape.fanOut
+	}
+	if int64(len(urns)) != expect {
+		err = fmt.Errorf("malformed datashard: level %d %q %d lists %d urns but expected %d", level, kHashManifest, i, len(urns), expect)
+	}
+	return
+}
@@ -0,0 +1,583 @@
+package dshards
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/cjslep/syrup"
+)
+
+const (
+	testTreeSuiteName = "test-tree"
+	// testTreeOverhead leaves room for only a few URNs in each manifest,
+	// so that deep manifest trees are small.
+	testTreeOverhead = constChunkSize - 300
+)
+
+// testTreeSuite wraps a built-in suite, padding each Datashard so that only
+// a small chunk of plaintext fits. It records the IV of every Datashard it
+// encrypts.
+type testTreeSuite struct {
+	SuiteImpl
+	mu  sync.Mutex
+	ivs map[string]int
+}
+
+func (t *testTreeSuite) Overhead() int {
+	return testTreeOverhead
+}
+
+func (t *testTreeSuite) EncryptShard(plain []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	t.mu.Lock()
+	t.ivs[string(iv)]++
+	t.mu.Unlock()
+	b, err := t.SuiteImpl.EncryptShard(plain, key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, make([]byte, testTreeOverhead)...), nil
+}
+
+func (t *testTreeSuite) DecryptShard(b []byte, key SymmetricKey, iv []byte) ([]byte, error) {
+	if len(b) < testTreeOverhead {
+		return nil, fmt.Errorf("test tree suite datashard of %d bytes is too short", len(b))
+	}
+	return t.SuiteImpl.DecryptShard(b[:len(b)-testTreeOverhead], key, iv)
+}
+
+// reset forgets the recorded IVs.
+func (t *testTreeSuite) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ivs = make(map[string]int)
+}
+
+var testTreeSuiteImpl *testTreeSuite
+
+func init() {
+	impl, err := PROTO_ZERO_SUITE.impl()
+	if err != nil {
+		panic(err)
+	}
+	testTreeSuiteImpl = &testTreeSuite{SuiteImpl: impl, ivs: make(map[string]int)}
+	RegisterSuite(testTreeSuiteName, testTreeSuiteImpl)
+}
+
+func TestManifestTree(t *testing.T) {
+	s := Suite(testTreeSuiteName)
+	shape, err := newTreeShape(s, 0)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	} else if shape.fanOut < 2 || shape.fanOut > 8 {
+		t.Fatalf("got fan-out %d, want a small tree for testing", shape.fanOut)
+	}
+	n, f := int(shape.chunkLen), int(shape.fanOut)
+	tests := []struct {
+		name        string
+		len         int
+		variadic    bool
+		expectLevel int
+	}{
+		{
+			name:        "One Level",
+			len:         2*n + 1,
+			expectLevel: 1,
+		},
+		{
+			name:        "One Full Level",
+			len:         f * n,
+			expectLevel: 1,
+		},
+		{
+			name:        "Two Levels",
+			len:         f*n + 1,
+			expectLevel: 2,
+		},
+		{
+			name:        "Two Full Levels",
+			len:         f * f * n,
+			variadic:    true,
+			expectLevel: 2,
+		},
+		{
+			name:        "Three Levels",
+			len:         f*f*n + 1,
+			expectLevel: 3,
+		},
+		{
+			name:        "Three Uneven Levels",
+			len:         (f*f+f+1)*n - 7,
+			variadic:    true,
+			expectLevel: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			testTreeSuiteImpl.reset()
+			opts := EncryptOptions{VariadicChunks: test.variadic}
+			rootIdx, priv, err := opts.Encrypt(plain, testSymmKey, s)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			for iv, count := range testTreeSuiteImpl.ivs {
+				if count > 1 {
+					t.Errorf("got iv %x used by %d datashards", iv, count)
+				}
+			}
+
+			shape, err := newTreeShape(s, int64(test.len))
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			} else if shape.height() != test.expectLevel {
+				t.Fatalf("got height %d, want %d", shape.height(), test.expectLevel)
+			}
+			expectCount := 0
+			for level := 0; level <= test.expectLevel; level++ {
+				expectCount += int(shape.count(level))
+			}
+			if len(priv) != expectCount {
+				t.Errorf("got %d datashards, want %d", len(priv), expectCount)
+			}
+			r, err := Decrypt(priv[rootIdx], s)
+			if err != nil {
+				t.Fatalf("got decrypt error: %s", err)
+			} else if r.level != test.expectLevel-1 {
+				t.Errorf("got root listing level %d, want %d", r.level, test.expectLevel-1)
+			}
+
+			opts.Workers = 3
+			_, parallel, err := opts.Encrypt(plain, testSymmKey, s)
+			if err != nil {
+				t.Fatalf("got encrypt error: %s", err)
+			}
+			for i := range priv {
+				if !bytes.Equal(parallel[i].Content, priv[i].Content) {
+					t.Fatalf("got different datashard %d with workers", i)
+				}
+			}
+
+			if got := decryptShards(t, rootIdx, priv, s); !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+			ctx := context.Background()
+			fetcher := newTestFetcher(t, priv)
+			if got, err := (DecryptOptions{Workers: 4}).DecryptAll(ctx, priv[rootIdx].AddressAndKey, fetcher); err != nil {
+				t.Errorf("got decrypt all error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+			dr := NewDecryptingReader(priv[rootIdx], s, fetcher)
+			defer dr.Close()
+			if got, err := ioutil.ReadAll(dr); err != nil {
+				t.Errorf("got decrypting reader error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+			sf, err := NewShardFile(ctx, priv[rootIdx].AddressAndKey, fetcher)
+			if err != nil {
+				t.Fatalf("got shard file error: %s", err)
+			}
+			for _, off := range []int{0, n - 1, test.len / 2, test.len - n - 3} {
+				p := make([]byte, n+3)
+				if off+len(p) > test.len {
+					p = p[:test.len-off]
+				}
+				if _, err := sf.ReadAt(p, int64(off)); err != nil {
+					t.Errorf("got read at %d error: %s", off, err)
+				} else if !bytes.Equal(p, plain[off:off+len(p)]) {
+					t.Errorf("got %q at %d, want %q", p, off, plain[off:off+len(p)])
+				}
+			}
+		})
+	}
+}
+
+func TestManifestTreeMalformed(t *testing.T) {
+	s := Suite(testTreeSuiteName)
+	shape, err := newTreeShape(s, 0)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	n, f := shape.chunkLen, shape.fanOut
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	urns := func(count int64) []URN {
+		us := make([]URN, count)
+		for i := range us {
+			us[i] = u
+		}
+		return us
+	}
+	other, err := NewURN(SHA512_256, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name string
+		m    manifest
+		hash Hash
+	}{
+		{
+			name: "Level Too High",
+			m:    manifest{urns: urns(2), size: 2 * n, level: 2},
+		},
+		{
+			name: "Level Too Low",
+			m:    manifest{urns: urns(2), size: f*n + 1, level: 1},
+		},
+		{
+			name: "Too Few URNs",
+			m:    manifest{urns: urns(2), size: 3 * n, level: 1},
+		},
+		{
+			name: "Too Many URNs",
+			m:    manifest{urns: urns(3), size: 2 * n, level: 1},
+		},
+		{
+			name: "Fits In One Datashard",
+			m:    manifest{urns: urns(1), size: n, level: 1},
+		},
+		{
+			name: "Wrong Hash",
+			m:    manifest{urns: []URN{other, other}, size: 2 * n, level: 1},
+			hash: SHA512_256,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := test.hash
+			if h == "" {
+				h = SHA256D
+			}
+			plain, err := test.m.Encode(h, true, false, testTreeOverhead)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			root, err := encryptChunk(plain, testSymmKey, s, 0, ivEntryPoint)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if _, err = Decrypt(root, s); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+// encryptLegacy encrypts the content under a legacy manifest, as it was before
+// manifests recorded their level. Manifests concatenate URN strings, split
+// across as many parts as needed, and every datashard below the root uses the
+// content IVs.
+func encryptLegacy(t *testing.T, plain []byte, key SymmetricKey, s Suite) (rootIdx int, priv []PrivateShard) {
+	impl, err := s.impl()
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	size := constChunkSize - impl.Overhead()
+	// encryptLevel encrypts the content split into chunks of n bytes,
+	// returning the concatenated URN strings of the chunks.
+	encryptLevel := func(content []byte, eachChunk []interface{}, n int) (urns []byte) {
+		for i := 0; len(content) > 0; i++ {
+			c := content
+			if len(c) > n {
+				c = c[:n]
+			}
+			content = content[len(c):]
+			b, err := encodeChunk(eachChunk, c, size)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			p, err := encryptChunk(b, key, s, uint64(i), ivContent)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			priv = append(priv, p)
+			u, err := p.AddressAndKey.URN()
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			urns = append(urns, u.String()...)
+		}
+		return
+	}
+	n, err := chunkCapacity([]interface{}{kRaw}, size)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	m, err := chunkCapacity([]interface{}{kManifest, constChunkSize, int64(math.MaxInt64)}, size)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	rootPrefix := []interface{}{kRaw}
+	content := plain
+	if len(plain) > n {
+		content = encryptLevel(plain, []interface{}{kRaw}, n)
+		for len(content) > m {
+			content = encryptLevel(content, []interface{}{kManifest, constChunkSize, int64(0)}, m)
+		}
+		rootPrefix = []interface{}{kManifest, constChunkSize, int64(len(plain))}
+	}
+	b, err := encodeChunk(rootPrefix, content, size)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	root, err := encryptChunk(b, key, s, 0, ivEntryPoint)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	return len(priv), append(priv, root)
+}
+
+func TestLegacyManifestTree(t *testing.T) {
+	s := Suite(testTreeSuiteName)
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize-testTreeOverhead)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	m, err := chunkCapacity([]interface{}{kManifest, constChunkSize, int64(math.MaxInt64)}, constChunkSize-testTreeOverhead)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	// The number of URNs that fit in a single manifest.
+	f := m / len(u.String())
+	tests := []struct {
+		name string
+		len  int
+	}{
+		{
+			name: "Single Shard",
+			len:  n - 1,
+		},
+		{
+			name: "One Level",
+			len:  2*n + 1,
+		},
+		{
+			name: "Two Levels",
+			len:  (f+1)*n + 1,
+		},
+		{
+			name: "Three Levels",
+			len:  (f*f+1)*n + 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := testContent(test.len)
+			rootIdx, priv := encryptLegacy(t, plain, testSymmKey, s)
+			fetcher := newTestFetcher(t, priv)
+			got, err := DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, fetcher)
+			if err != nil {
+				t.Fatalf("got decrypt error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got len %d, want len %d", len(got), len(plain))
+			}
+			got, err = ioutil.ReadAll(NewDecryptingReader(priv[rootIdx], s, fetcher))
+			if err != nil {
+				t.Fatalf("got read error: %s", err)
+			} else if !bytes.Equal(got, plain) {
+				t.Errorf("got read len %d, want len %d", len(got), len(plain))
+			}
+			sf, err := NewShardFile(context.Background(), priv[rootIdx].AddressAndKey, fetcher)
+			if err != nil {
+				t.Fatalf("got shard file error: %s", err)
+			}
+			off := len(plain) / 3
+			got = make([]byte, len(plain)-off)
+			if _, err = sf.ReadAt(got, int64(off)); err != nil {
+				t.Fatalf("got read at error: %s", err)
+			} else if !bytes.Equal(got, plain[off:]) {
+				t.Errorf("got content at %d that differs", off)
+			}
+		})
+	}
+}
+
+func TestManifestFanOut(t *testing.T) {
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	for _, s := range []Suite{PROTO_ZERO_SUITE, PROTO_ZERO_AEAD_SUITE, testTreeSuiteName} {
+		t.Run(string(s), func(t *testing.T) {
+			impl, err := s.impl()
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			f, err := manifestFanOut(s)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			m := manifest{size: math.MaxInt64, level: maxManifestLevel}
+			for i := 0; i < f; i++ {
+				m.urns = append(m.urns, u)
+			}
+			if _, err = m.Encode(SHA256D, false, false, impl.Overhead()); err != nil {
+				t.Errorf("got error encoding %d urns: %s", f, err)
+			}
+			m.urns = append(m.urns, u)
+			if _, err = m.Encode(SHA256D, false, false, impl.Overhead()); err == nil {
+				t.Errorf("got no error encoding %d urns", f+1)
+			}
+		})
+	}
+}
+
+func TestDecodeManifestHashes(t *testing.T) {
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name      string
+		v         []interface{}
+		expectErr bool
+	}{
+		{
+			name: "Hashes",
+			v:    []interface{}{kHashManifest, constChunkSize, 10, 1, string(SHA256D), [][]byte{u.hash, u.hash}},
+		},
+		{
+			name:      "Legacy Manifest With Level",
+			v:         []interface{}{kManifest, constChunkSize, 10, 1, []byte(u.String() + u.String())},
+			expectErr: true,
+		},
+		{
+			name:      "Unknown Hash",
+			v:         []interface{}{kHashManifest, constChunkSize, 10, 1, "nonexistent", [][]byte{u.hash}},
+			expectErr: true,
+		},
+		{
+			name:      "Short Hash",
+			v:         []interface{}{kHashManifest, constChunkSize, 10, 1, string(SHA256D), [][]byte{u.hash[1:]}},
+			expectErr: true,
+		},
+		{
+			name:      "Not A List",
+			v:         []interface{}{kHashManifest, constChunkSize, 10, 1, string(SHA256D), u.hash},
+			expectErr: true,
+		},
+		{
+			name:      "Hash Not Bytes",
+			v:         []interface{}{kHashManifest, constChunkSize, 10, 1, string(SHA256D), []interface{}{u.String()}},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(test.v); err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			d, err := decodeShard(buf.Bytes())
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("got no error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if len(d.urns) != 2 || d.urns[0].String() != u.String() || d.hash != SHA256D {
+				t.Errorf("got %v of %q, want two %s", d.urns, d.hash, u)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyManifest(t *testing.T) {
+	u, err := NewURN(SHA256D, []byte("child"))
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	tests := []struct {
+		name      string
+		v         []interface{}
+		expectErr bool
+	}{
+		{
+			name: "URNs",
+			v:    []interface{}{kManifest, constChunkSize, 10, []byte(u.String() + u.String())},
+		},
+		{
+			name:      "No URNs",
+			v:         []interface{}{kManifest, constChunkSize, 10, []byte{}},
+			expectErr: true,
+		},
+		{
+			name:      "Not A URN",
+			v:         []interface{}{kManifest, constChunkSize, 10, []byte("hello")},
+			expectErr: true,
+		},
+		{
+			name:      "Negative Length",
+			v:         []interface{}{kManifest, constChunkSize, -1, []byte(u.String())},
+			expectErr: true,
+		},
+		{
+			name:      "Content Not Bytes",
+			v:         []interface{}{kManifest, constChunkSize, 10, u.String()},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(test.v); err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			r, err := decodeRoot(buf.Bytes(), PROTO_ZERO_SUITE)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("got no error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if !r.legacy || r.contentLen != 10 || len(r.fetch) != 2 || r.fetch[1].String() != u.String() {
+				t.Errorf("got %v of len %d, want two %s of len 10", r.fetch, r.contentLen, u)
+			}
+		})
+	}
+}
+
+func TestDecryptLegacyManifest(t *testing.T) {
+	n, err := chunkCapacity([]interface{}{kRaw}, constChunkSize)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	plain := testContent(2*n + 1)
+	rootIdx, priv := encryptLegacy(t, plain, testSymmKey, PROTO_ZERO_SUITE)
+	got, err := DecryptAll(context.Background(), priv[rootIdx].AddressAndKey, newTestFetcher(t, priv))
+	if err != nil {
+		t.Fatalf("got decrypt error: %s", err)
+	} else if !bytes.Equal(got, plain) {
+		t.Errorf("got len %d, want len %d", len(got), len(plain))
+	}
+
+	// Under the manifest tree, only the root manifest differs.
+	_, tree, err := Encrypt(plain, testSymmKey, PROTO_ZERO_SUITE)
+	if err != nil {
+		t.Fatalf("got encrypt error: %s", err)
+	} else if len(tree) != len(priv) {
+		t.Fatalf("got %d datashards, want %d", len(tree), len(priv))
+	}
+	for i := range tree {
+		if same := bytes.Equal(tree[i].Content, priv[i].Content); same != (i < len(tree)-1) {
+			t.Errorf("got %dth datashard the same as legacy %v", i, same)
+		}
+	}
+}
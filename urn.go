@@ -1,6 +1,7 @@
 package dshards
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"hash"
@@ -53,6 +54,19 @@ func NewURN(dsh Hash, content []byte) (s URN, err error) {
 	return
 }
 
+// Matches determines whether the content hashes to this URN.
+//
+// Expensive as it computes the hash of the content.
+func (s URN) Matches(content []byte) (ok bool, err error) {
+	var u URN
+	u, err = NewURN(s.dhash, content)
+	if err != nil {
+		return
+	}
+	ok = subtle.ConstantTimeCompare(u.hash, s.hash) == 1
+	return
+}
+
 // newURNForSuite is an internal constructor for IDSC, when the hash is
 // already known.
 func newURNForSuite(s Suite, hash []byte) (su URN, err error) {
@@ -61,6 +75,11 @@ func newURNForSuite(s Suite, hash []byte) (su URN, err error) {
 	return
 }
 
+// Algorithm returns the hash algorithm of this URN.
+func (s URN) Algorithm() Hash {
+	return s.dhash
+}
+
 func (s URN) String() string {
 	b := []byte(urnPrefix)
 	b = append(b, []byte(urnDelim)...)
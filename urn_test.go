@@ -18,6 +18,12 @@ func TestParseURN(t *testing.T) {
 			expectDHash: SHA256D,
 			expectHash:  []byte{95, 190, 20, 109, 77, 205, 160, 180, 192, 252, 219, 169, 139, 192, 225, 104, 159, 232, 66, 148, 61, 228, 161, 110, 144, 192, 36, 36, 154, 45, 42, 10},
 		},
+		{
+			name:        "BLAKE2b-256",
+			input:       "urn:blake2b-256:PAegbobllz94iQMaYh81ovZ7FVatdoYlae8DCl4-2NQ",
+			expectDHash: BLAKE2B_256,
+			expectHash:  []byte{60, 7, 160, 110, 134, 229, 151, 63, 120, 137, 3, 26, 98, 31, 53, 162, 246, 123, 21, 86, 173, 118, 134, 37, 105, 239, 3, 10, 94, 62, 216, 212},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -46,6 +52,18 @@ func TestNewURN(t *testing.T) {
 			content: []byte{228, 193, 64, 108, 49, 53, 219, 108, 198, 21, 88, 134, 52, 118, 198, 214, 117, 85, 40, 234, 45, 113, 128, 2, 99, 104, 77, 4, 225, 117, 218, 190, 14, 20, 231, 10, 60},
 			expect:  "urn:sha256d:JvaPnGGMmYdJGu8lEPy0JcMpfqQqC12hE42oOLjmx8k",
 		},
+		{
+			name:    "SHA512/256",
+			h:       SHA512_256,
+			content: []byte{228, 193, 64, 108, 49, 53, 219, 108, 198, 21, 88, 134, 52, 118, 198, 214, 117, 85, 40, 234, 45, 113, 128, 2, 99, 104, 77, 4, 225, 117, 218, 190, 14, 20, 231, 10, 60},
+			expect:  "urn:sha512-256:582zVwQA6H84ZfrbYvcI06JpGil-DapeUVK8-5-s7ZI",
+		},
+		{
+			name:    "BLAKE2b-256",
+			h:       BLAKE2B_256,
+			content: []byte{228, 193, 64, 108, 49, 53, 219, 108, 198, 21, 88, 134, 52, 118, 198, 214, 117, 85, 40, 234, 45, 113, 128, 2, 99, 104, 77, 4, 225, 117, 218, 190, 14, 20, 231, 10, 60},
+			expect:  "urn:blake2b-256:PAegbobllz94iQMaYh81ovZ7FVatdoYlae8DCl4-2NQ",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -83,3 +101,68 @@ func TestURNToString(t *testing.T) {
 		})
 	}
 }
+
+func TestURNMatches(t *testing.T) {
+	content := []byte{228, 193, 64, 108, 49, 53, 219, 108, 198, 21, 88, 134, 52, 118, 198, 214, 117, 85, 40, 234, 45, 113, 128, 2, 99, 104, 77, 4, 225, 117, 218, 190, 14, 20, 231, 10, 60}
+	tests := []struct {
+		name    string
+		urn     string
+		content []byte
+		expect  bool
+	}{
+		{
+			name:    "Matching",
+			urn:     "urn:sha256d:JvaPnGGMmYdJGu8lEPy0JcMpfqQqC12hE42oOLjmx8k",
+			content: content,
+			expect:  true,
+		},
+		{
+			name:    "Tampered",
+			urn:     "urn:sha256d:JvaPnGGMmYdJGu8lEPy0JcMpfqQqC12hE42oOLjmx8k",
+			content: append([]byte{0}, content[1:]...),
+			expect:  false,
+		},
+		{
+			name:    "Other URN",
+			urn:     "urn:sha256d:X74UbU3NoLTA_Nupi8DhaJ_oQpQ95KFukMAkJJotKgo",
+			content: content,
+			expect:  false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := ParseURN(test.urn)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			ok, err := u.Matches(test.content)
+			if err != nil {
+				t.Errorf("got error: %s", err)
+			} else if ok != test.expect {
+				t.Errorf("got %v, want %v", ok, test.expect)
+			}
+		})
+	}
+}
+
+func FuzzParseURN(f *testing.F) {
+	f.Add("urn:sha256d:gl6qBg6i3dc5dz9cylxPcxIWn4SgLdTxWFzyqtwIljk")
+	f.Add("urn:sha512-256:AAAA")
+	f.Add("urn:sha256d:")
+	f.Add("urn::")
+	f.Add("urn:nonexistent:AAAA")
+	f.Add("urn:sha256d:AA:AA")
+	f.Fuzz(func(t *testing.T, s string) {
+		u, err := ParseURN(s)
+		if err != nil {
+			return
+		}
+		// The string form of a parsed URN must parse to itself.
+		u2, err := ParseURN(u.String())
+		if err != nil {
+			t.Fatalf("got error reparsing %q: %s", u, err)
+		} else if u2.String() != u.String() {
+			t.Errorf("got %q, want %q", u2, u)
+		}
+	})
+}